@@ -0,0 +1,196 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"path"
+	"strconv"
+	"time"
+
+	bk "github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+func newScheduler() bk.Scheduler {
+	s, err := bk.NewScheduler(*scheduler)
+	if err != nil {
+		log.Fatalf("[scheduler] %v\n", err)
+	}
+	return s
+}
+
+// findBooking returns the booking with the id.
+func findBooking(bookingList []booking, id string) (booking, bool) {
+	for _, b := range bookingList {
+		if b.id == id {
+			return b, true
+		}
+	}
+	return booking{}, false
+}
+
+// program parses recpt1 command of b.
+func (b booking) program() (*epg.Program, error) {
+	return epg.ParseRecpt1Cmd(b.command, b.datetime)
+}
+
+// runRm deletes the bookings with the id or the filename matching the glob
+// pattern in args.
+func runRm(args []string) {
+	if len(args) == 0 {
+		log.Fatal("[rm] specify job id or filename pattern")
+	}
+	s := newScheduler()
+	bookingList := readBookings()
+	for _, a := range args {
+		matched := []booking{}
+		if b, ok := findBooking(bookingList, a); ok {
+			matched = append(matched, b)
+		} else {
+			for _, b := range bookingList {
+				ok, err := path.Match(a, b.filename)
+				if err != nil {
+					log.Fatalf("[rm] invalid pattern %v: %v", a, err)
+				}
+				if ok {
+					matched = append(matched, b)
+				}
+			}
+		}
+		if len(matched) == 0 {
+			log.Printf("[rm] no booking matched: %v", a)
+			continue
+		}
+		for _, b := range matched {
+			if err := s.Cancel(b.id); err != nil {
+				log.Printf("[rm] %v", err)
+				continue
+			}
+			fmt.Printf("removed %v %v %v\n", b.id, b.datetime.Format(time.ANSIC), b.filename)
+		}
+	}
+}
+
+// runShow prints the details of recpt1 command in the booking with the id.
+func runShow(args []string) {
+	if len(args) != 1 {
+		log.Fatal("[show] specify job id")
+	}
+	b, ok := findBooking(readBookings(), args[0])
+	if !ok {
+		log.Fatalf("[show] booking not found: %v", args[0])
+	}
+	p, err := b.program()
+	if err != nil {
+		log.Fatalf("[show] %v", err)
+	}
+	fmt.Printf("id:       %v\n", b.id)
+	fmt.Printf("start:    %v\n", p.Start.Format(time.ANSIC))
+	fmt.Printf("end:      %v\n", p.End.Format(time.ANSIC))
+	fmt.Printf("duration: %v\n", p.Duration())
+	fmt.Printf("channel:  %v (%v, %v)\n", p.Provider, p.Channel, p.Provider.Band())
+	fmt.Printf("file:     %v\n", b.filename)
+	fmt.Printf("command:  %v\n", b.command)
+}
+
+// runMove books the program in the booking with the id again at the new
+// start time, optionally with the new duration, and deletes the old booking.
+func runMove(args []string) {
+	if len(args) < 2 || len(args) > 3 {
+		log.Fatal("[move] specify job id, new start time (HHMM, MMDDHHMM or YYYYMMDDHHMM) and optional duration")
+	}
+	b, ok := findBooking(readBookings(), args[0])
+	if !ok {
+		log.Fatalf("[move] booking not found: %v", args[0])
+	}
+	p, err := b.moved(args[1:], time.Now())
+	if err != nil {
+		log.Fatalf("[move] %v", err)
+	}
+	d := p.Duration()
+
+	s := newScheduler()
+	id, err := s.Schedule(p)
+	if err != nil {
+		log.Fatalf("[move] failed to book: %v", err)
+	}
+	if err := s.Cancel(b.id); err != nil {
+		log.Fatalf("[move] booked %v but failed to remove %v: %v", id, b.id, err)
+	}
+	fmt.Printf("moved %v -> %v %v %v (%v)\n", b.id, id, p.Start.Format(time.ANSIC), p.Filename(), d)
+}
+
+// moved returns the program in b moved to the start time in args[0] with the
+// optional duration in args[1]. The program keeps the recpt1 options of b.
+func (b booking) moved(args []string, now time.Time) (*epg.Program, error) {
+	p, err := b.program()
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseStartTime(args[0], now)
+	if err != nil {
+		return nil, err
+	}
+	d := p.Duration()
+	if len(args) > 1 {
+		d, err = parseDuration(args[1])
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.Start = start
+	p.End = start.Add(d)
+	return p, nil
+}
+
+// parseStartTime parses s in HHMM, MMDDHHMM or YYYYMMDDHHMM format in local
+// time. HHMM and MMDDHHMM mean the next occurrence of the time after now.
+func parseStartTime(s string, now time.Time) (time.Time, error) {
+	switch len(s) {
+	case 4:
+		t, err := time.ParseInLocation("1504", s, time.Local)
+		if err != nil {
+			return time.Time{}, err
+		}
+		ret := time.Date(now.Year(), now.Month(), now.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		if ret.Before(now) {
+			ret = ret.AddDate(0, 0, 1)
+		}
+		return ret, nil
+	case 8:
+		t, err := time.ParseInLocation("01021504", s, time.Local)
+		if err != nil {
+			return time.Time{}, err
+		}
+		ret := time.Date(now.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		if ret.Before(now) {
+			ret = time.Date(now.Year()+1, t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, time.Local)
+		}
+		return ret, nil
+	case 12:
+		return time.ParseInLocation("200601021504", s, time.Local)
+	}
+	return time.Time{}, fmt.Errorf("unsupported time format: %v", s)
+}
+
+// parseDuration parses s as seconds like recpt1, or as time.Duration such as "35m".
+func parseDuration(s string) (time.Duration, error) {
+	if sec, err := strconv.Atoi(s); err == nil {
+		return time.Duration(sec) * time.Second, nil
+	}
+	return time.ParseDuration(s)
+}
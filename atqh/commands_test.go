@@ -0,0 +1,70 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseStartTime(t *testing.T) {
+	cases := []struct {
+		now  time.Time
+		s    string
+		want time.Time
+	}{
+		{time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local), "0800", time.Date(2018, 1, 15, 8, 0, 0, 0, time.Local)},
+		{time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local), "0700", time.Date(2018, 1, 16, 7, 0, 0, 0, time.Local)},
+		{time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local), "02012100", time.Date(2018, 2, 1, 21, 0, 0, 0, time.Local)},
+		// the date already passed in this year is the one in next year.
+		{time.Date(2018, 12, 20, 7, 30, 0, 0, time.Local), "01022100", time.Date(2019, 1, 2, 21, 0, 0, 0, time.Local)},
+		{time.Date(2018, 12, 20, 7, 30, 0, 0, time.Local), "201901022100", time.Date(2019, 1, 2, 21, 0, 0, 0, time.Local)},
+	}
+	for _, c := range cases {
+		out, err := parseStartTime(c.s, c.now)
+		if err != nil {
+			t.Fatalf("%s: error: %s", c.s, err)
+		}
+		if !out.Equal(c.want) {
+			t.Fatalf("%s: want: %s, out: %s", c.s, c.want, out)
+		}
+	}
+	if _, err := parseStartTime("2100x", time.Now()); err == nil {
+		t.Fatalf("want: error, out: nil")
+	}
+}
+
+func Test_bookingMoved(t *testing.T) {
+	now := time.Date(2018, 1, 15, 7, 0, 0, 0, time.Local)
+	b := newBooking("12", time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local), "20180115T0730-ピタゴラスイッチ.ts",
+		"recpt1 --b25 --sid 1024 --device /dev/pt3video1 26 900 20180115T0730-ピタゴラスイッチ.ts")
+	cases := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"0745"}, "recpt1 --b25 --sid 1024 --device /dev/pt3video1 26 900 20180115T0745-ピタゴラスイッチ.ts"},
+		{[]string{"0745", "30m"}, "recpt1 --b25 --sid 1024 --device /dev/pt3video1 26 1800 20180115T0745-ピタゴラスイッチ.ts"},
+		{[]string{"01160730", "600"}, "recpt1 --b25 --sid 1024 --device /dev/pt3video1 26 600 20180116T0730-ピタゴラスイッチ.ts"},
+	}
+	for _, c := range cases {
+		p, err := b.moved(c.args, now)
+		if err != nil {
+			t.Fatalf("%v: error: %s", c.args, err)
+		}
+		if out := p.Recpt1Cmd(); out != c.want {
+			t.Fatalf("%v: want: %s, out: %s", c.args, c.want, out)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// slot is a period when the same set of recordings overlap.
+type slot struct {
+	start    time.Time
+	end      time.Time
+	bookings []booking
+}
+
+// need returns the number of tuners required in s for each band.
+func (s slot) need() epg.Tuners {
+	n := epg.Tuners{}
+	for _, b := range s.bookings {
+		n[b.channel.Band()]++
+	}
+	return n
+}
+
+// exceeds returns true if s requires more tuners than tuners in any band.
+func (s slot) exceeds(tuners epg.Tuners) bool {
+	for band, n := range s.need() {
+		if n > tuners[band] {
+			return true
+		}
+	}
+	return false
+}
+
+// findSlots returns the periods when two or more recordings in bookingList
+// overlap. Adjacent periods are separated when the set of recordings changes.
+func findSlots(bookingList []booking) []slot {
+	points := []time.Time{}
+	for _, b := range bookingList {
+		points = append(points, b.datetime, b.end())
+	}
+	sort.Slice(points, func(i, j int) bool { return points[i].Before(points[j]) })
+
+	slots := []slot{}
+	for i := 0; i+1 < len(points); i++ {
+		start, end := points[i], points[i+1]
+		if !start.Before(end) {
+			continue
+		}
+		active := []booking{}
+		for _, b := range bookingList {
+			if !b.datetime.After(start) && b.end().After(start) {
+				active = append(active, b)
+			}
+		}
+		if len(active) < 2 {
+			continue
+		}
+		if n := len(slots); n > 0 && slots[n-1].end.Equal(start) && sameBookings(slots[n-1].bookings, active) {
+			slots[n-1].end = end
+			continue
+		}
+		slots = append(slots, slot{start: start, end: end, bookings: active})
+	}
+	return slots
+}
+
+func sameBookings(a, b []booking) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].id != b[i].id {
+			return false
+		}
+	}
+	return true
+}
+
+// findDuplicates returns the groups of bookings recording the same channel
+// from the same start time.
+func findDuplicates(bookingList []booking) [][]booking {
+	groups := map[string][]booking{}
+	keys := []string{}
+	for _, b := range bookingList {
+		k := b.datetime.Format(time.RFC3339) + " " + string(b.channel)
+		if _, ok := groups[k]; !ok {
+			keys = append(keys, k)
+		}
+		groups[k] = append(groups[k], b)
+	}
+	dups := [][]booking{}
+	for _, k := range keys {
+		if len(groups[k]) > 1 {
+			dups = append(dups, groups[k])
+		}
+	}
+	return dups
+}
+
+// gap is a period when no recording uses the tuners of the band.
+type gap struct {
+	band  epg.Band
+	start time.Time
+	end   time.Time
+}
+
+// findGaps returns the free periods of each band between the recordings in
+// bookingList, sorted by band and start time.
+func findGaps(bookingList []booking) []gap {
+	gaps := []gap{}
+	for _, band := range []epg.Band{epg.Terrestrial, epg.BS} {
+		bs := []booking{}
+		for _, b := range bookingList {
+			if b.channel.Band() == band {
+				bs = append(bs, b)
+			}
+		}
+		sort.Stable(byDatetime(bs))
+		var busy time.Time
+		for i, b := range bs {
+			if i > 0 && busy.Before(b.datetime) {
+				gaps = append(gaps, gap{band: band, start: busy, end: b.datetime})
+			}
+			if b.end().After(busy) {
+				busy = b.end()
+			}
+		}
+	}
+	return gaps
+}
+
+// runConflicts prints the overlapping recordings with the tuners they need,
+// the duplicated bookings and the free periods of the tuners. It exits with status 1 if any slot requires
+// more tuners than available or any booking is duplicated.
+func runConflicts(args []string) {
+	if len(args) != 0 {
+		log.Fatal("[conflicts] no argument is required")
+	}
+	tuners := epg.Tuners{
+		epg.Terrestrial: *grTuners,
+		epg.BS:          *bsTuners,
+	}
+	bookingList := []booking{}
+	for _, b := range flagFilter().apply(readBookings()) {
+		if b.channel == "" {
+			log.Printf("[conflicts] skip %v: failed to parse recpt1 command: %v", b.id, b.command)
+			continue
+		}
+		bookingList = append(bookingList, b)
+	}
+	sort.Stable(byDatetime(bookingList))
+	if reportConflicts(os.Stdout, bookingList, tuners) {
+		os.Exit(1)
+	}
+}
+
+// reportConflicts writes the result of the audit into w, and returns true if
+// any problem is found.
+func reportConflicts(w io.Writer, bookingList []booking, tuners epg.Tuners) bool {
+	found := false
+	dups := findDuplicates(bookingList)
+	if len(dups) > 0 {
+		found = true
+		fmt.Fprintln(w, "duplicates:")
+		for _, d := range dups {
+			ids := []string{}
+			for _, b := range d {
+				ids = append(ids, b.id)
+			}
+			b := d[0]
+			fmt.Fprintf(w, "  %v %v %v %v\n", strings.Join(ids, ","), b.datetime.Format("2006-01-02 15:04"), b.channel.Name(), b.title)
+		}
+	}
+	slots := findSlots(bookingList)
+	if len(slots) > 0 {
+		fmt.Fprintln(w, "overlaps:")
+	}
+	for _, s := range slots {
+		need := s.need()
+		mark := ""
+		if s.exceeds(tuners) {
+			found = true
+			mark = " !!"
+		}
+		fmt.Fprintf(w, "  %v - %v  GR %d/%d  BS %d/%d%v\n",
+			s.start.Format("2006-01-02 15:04"), s.end.Format("15:04"),
+			need[epg.Terrestrial], tuners[epg.Terrestrial], need[epg.BS], tuners[epg.BS], mark)
+		for _, b := range s.bookings {
+			fmt.Fprintf(w, "    %v %v-%v %v %v\n", b.id, b.datetime.Format("15:04"), b.end().Format("15:04"), b.channel.Name(), b.title)
+		}
+	}
+	if !found && len(slots) == 0 {
+		fmt.Fprintln(w, "no conflicts")
+	}
+	gaps := findGaps(bookingList)
+	if len(gaps) > 0 {
+		fmt.Fprintln(w, "gaps:")
+	}
+	for _, g := range gaps {
+		fmt.Fprintf(w, "  %v %v - %v\n", g.band, g.start.Format("2006-01-02 15:04"), g.end.Format("2006-01-02 15:04"))
+	}
+	return found
+}
@@ -0,0 +1,111 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+func testBooking(id string, start time.Time, channel epg.Provider, minutes int) booking {
+	filename := start.Format(epg.FilePrefixFormat) + "-" + id + ".ts"
+	cmd := fmt.Sprintf("recpt1 --b25 --sid hd --strip %s %d %s", channel, minutes*60, filename)
+	return newBooking(id, start, filename, cmd)
+}
+
+func Test_findSlots(t *testing.T) {
+	base := time.Date(2018, 1, 15, 21, 0, 0, 0, time.Local)
+	bookingList := []booking{
+		testBooking("1", base, epg.NHK, 60),
+		testBooking("2", base.Add(30*time.Minute), epg.CX, 60),
+		testBooking("3", base.Add(30*time.Minute), epg.TX, 30),
+		testBooking("4", base.Add(30*time.Minute), epg.BS11, 30),
+		testBooking("5", base.Add(3*time.Hour), epg.NHK, 30),
+	}
+	slots := findSlots(bookingList)
+	if len(slots) != 1 {
+		t.Fatalf("want: 1 slot, out: %d", len(slots))
+	}
+	s := slots[0]
+	if !s.start.Equal(base.Add(30*time.Minute)) || !s.end.Equal(base.Add(time.Hour)) || len(s.bookings) != 4 {
+		t.Fatalf("want: 21:30-22:00 with 4 bookings, out: %s-%s with %d bookings", s.start, s.end, len(s.bookings))
+	}
+	need := s.need()
+	if need[epg.Terrestrial] != 3 || need[epg.BS] != 1 {
+		t.Fatalf("want: GR 3 BS 1, out: GR %d BS %d", need[epg.Terrestrial], need[epg.BS])
+	}
+	if !s.exceeds(epg.DefaultTuners) {
+		t.Fatalf("want: exceeds %v, out: not exceeded", epg.DefaultTuners)
+	}
+}
+
+func Test_findDuplicates(t *testing.T) {
+	base := time.Date(2018, 1, 15, 21, 0, 0, 0, time.Local)
+	bookingList := []booking{
+		testBooking("1", base, epg.NHK, 60),
+		testBooking("2", base, epg.NHK, 30),
+		testBooking("3", base, epg.CX, 60),
+	}
+	dups := findDuplicates(bookingList)
+	if len(dups) != 1 || len(dups[0]) != 2 || dups[0][0].id != "1" || dups[0][1].id != "2" {
+		t.Fatalf("want: [[1 2]], out: %v", dups)
+	}
+}
+
+func Test_findGaps(t *testing.T) {
+	base := time.Date(2018, 1, 15, 21, 0, 0, 0, time.Local)
+	bookingList := []booking{
+		testBooking("1", base, epg.NHK, 60),
+		testBooking("2", base.Add(30*time.Minute), epg.CX, 60),
+		testBooking("3", base.Add(2*time.Hour), epg.TX, 30),
+		testBooking("4", base, epg.BS11, 30),
+		testBooking("5", base.Add(30*time.Minute), epg.BS11, 30),
+		testBooking("6", base.Add(3*time.Hour), epg.BS11, 30),
+	}
+	want := []gap{
+		{epg.Terrestrial, base.Add(90 * time.Minute), base.Add(2 * time.Hour)},
+		{epg.BS, base.Add(time.Hour), base.Add(3 * time.Hour)},
+	}
+	gaps := findGaps(bookingList)
+	if len(gaps) != len(want) {
+		t.Fatalf("want: %v, out: %v", want, gaps)
+	}
+	for i, w := range want {
+		g := gaps[i]
+		if g.band != w.band || !g.start.Equal(w.start) || !g.end.Equal(w.end) {
+			t.Fatalf("want: %s %s-%s, out: %s %s-%s", w.band, w.start, w.end, g.band, g.start, g.end)
+		}
+	}
+}
+
+func Test_reportConflicts(t *testing.T) {
+	base := time.Date(2018, 1, 15, 21, 0, 0, 0, time.Local)
+	bookingList := []booking{
+		testBooking("1", base, epg.NHK, 30),
+		testBooking("2", base.Add(time.Hour), epg.CX, 30),
+	}
+	var out strings.Builder
+	if reportConflicts(&out, bookingList, epg.DefaultTuners) {
+		t.Fatalf("want: no problem, out: found")
+	}
+	want := "no conflicts\ngaps:\n  GR 2018-01-15 21:30 - 2018-01-15 22:00\n"
+	if out.String() != want {
+		t.Fatalf("want: %s, out: %s", want, out.String())
+	}
+}
@@ -0,0 +1,204 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// filter is the conditions to select bookings. Zero values match any booking.
+type filter struct {
+	// from and to are the range of the start time. to is exclusive.
+	from time.Time
+	to   time.Time
+	// channels are the provider IDs or the channel names.
+	channels []string
+	title    *regexp.Regexp
+	// overlapFrom and overlapTo are the time window which the recording
+	// should overlap with.
+	overlapFrom time.Time
+	overlapTo   time.Time
+}
+
+// newFilter builds filter from the values of the command line flags.
+func newFilter(from, to, channels, title, overlap string, now time.Time) (*filter, error) {
+	f := &filter{}
+	var err error
+	if from != "" {
+		if f.from, _, err = parseTimeArg(from, now); err != nil {
+			return nil, fmt.Errorf("invalid -from: %v", err)
+		}
+	}
+	if to != "" {
+		var dayOnly bool
+		if f.to, dayOnly, err = parseTimeArg(to, now); err != nil {
+			return nil, fmt.Errorf("invalid -to: %v", err)
+		}
+		// include the whole day when only the date is given.
+		if dayOnly {
+			f.to = f.to.AddDate(0, 0, 1)
+		}
+	}
+	for _, c := range strings.Split(channels, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			f.channels = append(f.channels, c)
+		}
+	}
+	if title != "" {
+		if f.title, err = regexp.Compile(title); err != nil {
+			return nil, fmt.Errorf("invalid -title: %v", err)
+		}
+	}
+	if overlap != "" {
+		if f.overlapFrom, f.overlapTo, err = parseWindow(overlap, now); err != nil {
+			return nil, fmt.Errorf("invalid -overlap: %v", err)
+		}
+	}
+	return f, nil
+}
+
+// match returns true if b satisfies all the conditions in f.
+func (f *filter) match(b booking) bool {
+	if !f.from.IsZero() && b.datetime.Before(f.from) {
+		return false
+	}
+	if !f.to.IsZero() && !b.datetime.Before(f.to) {
+		return false
+	}
+	if len(f.channels) > 0 && !f.matchChannel(b) {
+		return false
+	}
+	if f.title != nil {
+		title := b.title
+		if title == "" {
+			title = b.filename
+		}
+		if !f.title.MatchString(title) {
+			return false
+		}
+	}
+	if !f.overlapFrom.IsZero() {
+		if !b.datetime.Before(f.overlapTo) || !b.end().After(f.overlapFrom) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchChannel returns true if the channel of b is one of f.channels, either
+// by provider ID, or by the part of channel name.
+func (f *filter) matchChannel(b booking) bool {
+	if b.channel == "" {
+		return false
+	}
+	name := strings.ToLower(b.channel.Name())
+	for _, c := range f.channels {
+		if strings.EqualFold(c, string(b.channel)) || strings.Contains(name, strings.ToLower(c)) {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns the bookings matching f.
+func (f *filter) apply(bookingList []booking) []booking {
+	filtered := []booking{}
+	for _, b := range bookingList {
+		if f.match(b) {
+			filtered = append(filtered, b)
+		}
+	}
+	return filtered
+}
+
+var relativeDayRegexp = regexp.MustCompile(`^([+-]\d+)d$`)
+
+// parseTimeArg parses s as the time relative to now or the absolute time.
+// dayOnly is true if s specifies a date without time, in which case the
+// returned time is the beginning of the day.
+//
+//	now, today, tomorrow, yesterday
+//	+3d, -1d              days from today
+//	+2h, -30m             duration from now
+//	2018-01-15, 2018-01-15T07:30, 2018-01-15 07:30
+//	HHMM, MMDDHHMM, YYYYMMDDHHMM
+func parseTimeArg(s string, now time.Time) (t time.Time, dayOnly bool, err error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch s {
+	case "now":
+		return now, false, nil
+	case "today":
+		return today, true, nil
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true, nil
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true, nil
+	}
+	if m := relativeDayRegexp.FindStringSubmatch(s); m != nil {
+		days, err := strconv.Atoi(m[1])
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return today.AddDate(0, 0, days), true, nil
+	}
+	if strings.HasPrefix(s, "+") || strings.HasPrefix(s, "-") {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return time.Time{}, false, err
+		}
+		return now.Add(d), false, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, true, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04", "2006-01-02 15:04"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, false, nil
+		}
+	}
+	t, err = parseStartTime(s, now)
+	return t, false, err
+}
+
+// parseWindow parses the time window in "start,end" format. end can be the
+// duration from start, such as "start,2h".
+func parseWindow(s string, now time.Time) (time.Time, time.Time, error) {
+	parts := strings.SplitN(s, ",", 2)
+	if len(parts) != 2 {
+		return time.Time{}, time.Time{}, fmt.Errorf("window should be 'start,end': %v", s)
+	}
+	start, _, err := parseTimeArg(parts[0], now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if d, err := time.ParseDuration(parts[1]); err == nil {
+		return start, start.Add(d), nil
+	}
+	end, endDayOnly, err := parseTimeArg(parts[1], now)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if endDayOnly {
+		end = end.AddDate(0, 0, 1)
+	}
+	if !end.After(start) {
+		return time.Time{}, time.Time{}, fmt.Errorf("end must be after start: %v", s)
+	}
+	return start, end, nil
+}
@@ -0,0 +1,73 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_parseTimeArg(t *testing.T) {
+	now := time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local)
+	cases := map[string]time.Time{
+		"today":            time.Date(2018, 1, 15, 0, 0, 0, 0, time.Local),
+		"+3d":              time.Date(2018, 1, 18, 0, 0, 0, 0, time.Local),
+		"-1d":              time.Date(2018, 1, 14, 0, 0, 0, 0, time.Local),
+		"+2h":              time.Date(2018, 1, 15, 9, 30, 0, 0, time.Local),
+		"2018-02-01":       time.Date(2018, 2, 1, 0, 0, 0, 0, time.Local),
+		"2018-02-01T21:00": time.Date(2018, 2, 1, 21, 0, 0, 0, time.Local),
+		"201802012100":     time.Date(2018, 2, 1, 21, 0, 0, 0, time.Local),
+	}
+	for s, want := range cases {
+		out, _, err := parseTimeArg(s, now)
+		if err != nil {
+			t.Fatalf("%s: error: %s", s, err)
+		}
+		if !out.Equal(want) {
+			t.Fatalf("%s: want: %s, out: %s", s, want, out)
+		}
+	}
+}
+
+func Test_filter(t *testing.T) {
+	now := time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local)
+	b := newBooking("12", now, "20180115T0730-ピタゴラスイッチ.ts",
+		"recpt1 --b25 --sid hd --strip 26 900 20180115T0730-ピタゴラスイッチ.ts")
+	if b.sid != "hd" || b.channel != "26" || b.duration != 15*time.Minute || b.title != "ピタゴラスイッチ" {
+		t.Fatalf("want: hd 26 15m0s ピタゴラスイッチ, out: %s %s %s %s", b.sid, b.channel, b.duration, b.title)
+	}
+	cases := []struct {
+		from, to, channel, title, overlap string
+		want                              bool
+	}{
+		{from: "today", to: "today", want: true},
+		{from: "tomorrow", want: false},
+		{channel: "Eテレ", want: true},
+		{channel: "27,BS15_0", want: false},
+		{title: "^ピタゴラ", want: true},
+		{title: "スペシャル", want: false},
+		{overlap: "0740,1h", want: true},
+		{overlap: "2018-01-15T07:45,2018-01-15T08:00", want: false},
+	}
+	for _, c := range cases {
+		f, err := newFilter(c.from, c.to, c.channel, c.title, c.overlap, now)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if out := f.match(b); out != c.want {
+			t.Fatalf("%+v: want: %v, out: %v", c, c.want, out)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// DefaultFormat is the output format of the original atqh.
+const DefaultFormat = "text"
+
+// icsTimeFormat is the UTC datetime format in iCalendar.
+const icsTimeFormat = "20060102T150405Z"
+
+// formatters write the booking list in each output format.
+var formatters = map[string]func(io.Writer, []booking) error{
+	"text":  writeText,
+	"table": writeTable,
+	"json":  writeJSON,
+	"csv":   writeCSV,
+	"ics":   writeICS,
+}
+
+// formatNames returns the available output formats.
+func formatNames() []string {
+	names := []string{}
+	for n := range formatters {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// writeBookings writes bookingList into w in the format.
+func writeBookings(w io.Writer, format string, bookingList []booking) error {
+	f, ok := formatters[format]
+	if !ok {
+		return fmt.Errorf("unknown format %q: available formats are %s", format, strings.Join(formatNames(), ", "))
+	}
+	return f(w, bookingList)
+}
+
+// record is the booking with the fields parsed out of the recpt1 command.
+type record struct {
+	ID       string    `json:"id"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Duration int       `json:"duration"`
+	Title    string    `json:"title"`
+	Channel  string    `json:"channel"`
+	Provider string    `json:"provider"`
+	SID      string    `json:"sid"`
+	Filename string    `json:"filename"`
+	Command  string    `json:"command"`
+}
+
+// newRecord converts b into record. The fields from recpt1 command are left
+// empty when the command can't be parsed.
+func newRecord(b booking) record {
+	r := record{
+		ID:       b.id,
+		Start:    b.datetime,
+		End:      b.end(),
+		Duration: int(b.duration / time.Second),
+		Title:    b.title,
+		Provider: string(b.channel),
+		SID:      b.sid,
+		Filename: b.filename,
+		Command:  b.command,
+	}
+	if b.channel != "" {
+		r.Channel = b.channel.Name()
+	}
+	return r
+}
+
+func writeText(w io.Writer, bookingList []booking) error {
+	for _, b := range bookingList {
+		if _, err := fmt.Fprintf(w, "%v %v %v\n", b.id, b.datetime.Format(time.ANSIC), b.filename); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeTable(w io.Writer, bookingList []booking) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTART\tDURATION\tCHANNEL\tTITLE")
+	for _, b := range bookingList {
+		r := newRecord(b)
+		d := time.Duration(r.Duration) * time.Second
+		fmt.Fprintf(tw, "%v\t%v\t%v\t%v\t%v\n", r.ID, r.Start.Format("2006-01-02 15:04"), d, r.Channel, r.Title)
+	}
+	return tw.Flush()
+}
+
+func writeJSON(w io.Writer, bookingList []booking) error {
+	records := []record{}
+	for _, b := range bookingList {
+		records = append(records, newRecord(b))
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+func writeCSV(w io.Writer, bookingList []booking) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "start", "end", "duration", "title", "channel", "provider", "sid", "filename", "command"})
+	for _, b := range bookingList {
+		r := newRecord(b)
+		cw.Write([]string{
+			r.ID,
+			r.Start.Format(time.RFC3339),
+			r.End.Format(time.RFC3339),
+			strconv.Itoa(r.Duration),
+			r.Title,
+			r.Channel,
+			r.Provider,
+			r.SID,
+			r.Filename,
+			r.Command,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeICS writes the bookings as iCalendar feed (RFC 5545).
+func writeICS(w io.Writer, bookingList []booking) error {
+	lines := []string{
+		"BEGIN:VCALENDAR",
+		"VERSION:2.0",
+		"PRODID:-//ymotongpoo//atqh//EN",
+		"CALSCALE:GREGORIAN",
+		"X-WR-CALNAME:Recordings",
+	}
+	stamp := time.Now().UTC().Format(icsTimeFormat)
+	for _, b := range bookingList {
+		r := newRecord(b)
+		summary := r.Title
+		if summary == "" {
+			summary = r.Filename
+		}
+		lines = append(lines,
+			"BEGIN:VEVENT",
+			"UID:"+icsEscape(r.ID+"-"+r.Start.UTC().Format(icsTimeFormat)+"@atqh"),
+			"DTSTAMP:"+stamp,
+			"DTSTART:"+r.Start.UTC().Format(icsTimeFormat),
+			"DTEND:"+r.End.UTC().Format(icsTimeFormat),
+			"SUMMARY:"+icsEscape(summary),
+			"LOCATION:"+icsEscape(r.Channel),
+			"DESCRIPTION:"+icsEscape(fmt.Sprintf("%v (%v)\n%v", r.Provider, time.Duration(r.Duration)*time.Second, r.Command)),
+			"END:VEVENT",
+		)
+	}
+	lines = append(lines, "END:VCALENDAR")
+	for _, l := range lines {
+		if _, err := io.WriteString(w, icsFold(l)+"\r\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var icsReplacer = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+
+// icsEscape escapes s as TEXT value in iCalendar.
+func icsEscape(s string) string {
+	return icsReplacer.Replace(s)
+}
+
+// icsFold folds l into the lines of 75 octets at most without breaking
+// multibyte characters.
+func icsFold(l string) string {
+	const max = 75
+	var sb strings.Builder
+	n := 0
+	for _, r := range l {
+		size := len(string(r))
+		if n+size > max {
+			sb.WriteString("\r\n ")
+			n = 1
+		}
+		sb.WriteRune(r)
+		n += size
+	}
+	return sb.String()
+}
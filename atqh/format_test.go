@@ -0,0 +1,141 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func testBookings() []booking {
+	start := time.Date(2018, 1, 15, 7, 30, 0, 0, time.UTC)
+	return []booking{
+		newBooking("12", start, "20180115T0730-ピタゴラスイッチ.ts",
+			"recpt1 --b25 --sid hd --strip 26 900 20180115T0730-ピタゴラスイッチ.ts"),
+		newBooking("13", start.Add(time.Hour), "20180115T0830-ニュース,天気;交通.ts",
+			"recpt1 --b25 --sid hd --strip 27 1800 20180115T0830-ニュース,天気;交通.ts"),
+	}
+}
+
+func Test_icsEscape(t *testing.T) {
+	cases := map[string]string{
+		"ニュース":           "ニュース",
+		"a,b;c":          `a\,b\;c`,
+		`C:\rec`:         `C:\\rec`,
+		"line1\nline2":   `line1\nline2`,
+		"line1\r\nline2": `line1\nline2`,
+	}
+	for s, want := range cases {
+		if out := icsEscape(s); out != want {
+			t.Fatalf("%q: want: %s, out: %s", s, want, out)
+		}
+	}
+}
+
+func Test_icsFold(t *testing.T) {
+	cases := []string{
+		"SUMMARY:short",
+		"SUMMARY:" + strings.Repeat("a", 200),
+		// 3 octets each, which doesn't fit the line boundary.
+		"SUMMARY:" + strings.Repeat("ピタゴラスイッチ", 10),
+		"SUMMARY:a" + strings.Repeat("🎬", 40),
+	}
+	for _, l := range cases {
+		out := icsFold(l)
+		for _, fl := range strings.Split(out, "\r\n") {
+			if len(fl) > 75 {
+				t.Fatalf("want: 75 octets at most, out: %d octets %q", len(fl), fl)
+			}
+			if !utf8.ValidString(fl) {
+				t.Fatalf("want: valid UTF-8, out: %q", fl)
+			}
+		}
+		if unfolded := strings.Replace(out, "\r\n ", "", -1); unfolded != l {
+			t.Fatalf("want: %s, out: %s", l, unfolded)
+		}
+	}
+}
+
+func Test_writeICS(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeBookings(&b, "ics", testBookings()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	out := b.String()
+	if !strings.HasSuffix(out, "END:VCALENDAR\r\n") {
+		t.Fatalf("want: ends with END:VCALENDAR, out: %q", out)
+	}
+	if strings.Count(out, "\n") != strings.Count(out, "\r\n") {
+		t.Fatalf("want: CRLF line endings, out: %q", out)
+	}
+	unfolded := strings.Replace(out, "\r\n ", "", -1)
+	for _, want := range []string{
+		"DTSTART:20180115T073000Z\r\n",
+		"DTEND:20180115T074500Z\r\n",
+		`SUMMARY:ニュース\,天気\;交通` + "\r\n",
+		`DESCRIPTION:27 (30m0s)\nrecpt1 --b25`,
+	} {
+		if !strings.Contains(unfolded, want) {
+			t.Fatalf("want: %q, out: %q", want, unfolded)
+		}
+	}
+	if strings.Count(out, "BEGIN:VEVENT") != 2 {
+		t.Fatalf("want: 2 events, out: %q", out)
+	}
+}
+
+func Test_writeBookings(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeBookings(&b, "json", testBookings()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	records := []record{}
+	if err := json.Unmarshal(b.Bytes(), &records); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(records) != 2 || records[0].Title != "ピタゴラスイッチ" || records[0].Duration != 900 || records[1].SID != "hd" {
+		t.Fatalf("want: 2 records, out: %+v", records)
+	}
+
+	b.Reset()
+	if err := writeBookings(&b, "csv", testBookings()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	rows, err := csv.NewReader(&b).ReadAll()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(rows) != 3 || rows[0][0] != "id" || rows[2][4] != "ニュース,天気;交通" || rows[2][3] != "1800" {
+		t.Fatalf("want: header and 2 rows, out: %v", rows)
+	}
+
+	b.Reset()
+	if err := writeBookings(&b, "table", testBookings()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(b.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "ID") || !strings.Contains(lines[1], "15m0s") {
+		t.Fatalf("want: header and 2 rows, out: %q", b.String())
+	}
+
+	if err := writeBookings(&b, "xml", testBookings()); err == nil {
+		t.Fatalf("want: error, out: nil")
+	}
+}
@@ -1,3 +1,12 @@
 module atqh
 
 go 1.12
+
+require (
+	github.com/ymotongpoo/toolbox/booking v0.0.0
+	github.com/ymotongpoo/toolbox/epg v0.0.0
+)
+
+replace github.com/ymotongpoo/toolbox/booking => ../booking
+
+replace github.com/ymotongpoo/toolbox/epg => ../epg
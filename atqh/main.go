@@ -20,11 +20,15 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"os"
 	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	bk "github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
 )
 
 const MaxAtCommand = 1000
@@ -33,6 +37,44 @@ type booking struct {
 	id       string
 	datetime time.Time
 	filename string
+	command  string
+
+	// fields parsed from recpt1 command.
+	sid      string
+	channel  epg.Provider
+	duration time.Duration
+	title    string
+}
+
+// newBooking creates booking of the job with the id running command at
+// datetime, and fills the fields parsed from the recpt1 command if possible.
+func newBooking(id string, datetime time.Time, filename, command string) booking {
+	b := booking{
+		id:       id,
+		datetime: datetime,
+		filename: filename,
+		command:  command,
+	}
+	p, err := epg.ParseRecpt1Cmd(command, datetime)
+	if err != nil {
+		return b
+	}
+	b.channel = p.Provider
+	b.duration = p.Duration()
+	b.title = p.Title
+	fields := strings.Fields(command)
+	for i := 1; i < len(fields)-1; i++ {
+		if fields[i] == "--sid" {
+			b.sid = fields[i+1]
+			break
+		}
+	}
+	return b
+}
+
+// end returns the time when the recording of b finishes.
+func (b booking) end() time.Time {
+	return b.datetime.Add(b.duration)
 }
 
 type byDatetime []booking
@@ -47,34 +89,56 @@ func (bi byID) Len() int           { return len(bi) }
 func (bi byID) Swap(i, j int)      { bi[i], bi[j] = bi[j], bi[i] }
 func (bi byID) Less(i, j int) bool { return bi[i].id < bi[j].id }
 
-var option = flag.Bool("id", false, "sort by id")
+var (
+	option    = flag.Bool("id", false, "sort by id")
+	atSource  = flag.String("source", "auto", "how to read at jobs. 'spool' parses the files in -spool, 'exec' runs atq and at -c, and 'auto' falls back to 'exec' when -spool is not readable.")
+	spool     = flag.String("spool", DefaultSpoolDir, "atd spool directory")
+	scheduler = flag.String("scheduler", bk.DefaultScheduler, "scheduler to read bookings from. 'at', 'systemd', 'systemd-user' or 'recorder' is available.")
+	format    = flag.String("format", DefaultFormat, "output format. 'text', 'table', 'json', 'csv' or 'ics' is available.")
+	from      = flag.String("from", "", "show bookings starting at or after the time. eg. 'today', '+3d', '2018-01-15', '2018-01-15T07:30'")
+	to        = flag.String("to", "", "show bookings starting before the time. the whole day is included if only the date is given")
+	channel   = flag.String("channel", "", "comma separated provider IDs or channel names to show")
+	title     = flag.String("title", "", "regular expression to match titles to show")
+	overlap   = flag.String("overlap", "", "show bookings overlapping with the time window 'start,end' or 'start,duration'")
+	grTuners  = flag.Int("gr-tuners", epg.DefaultTuners[epg.Terrestrial], "number of terrestrial tuners")
+	bsTuners  = flag.Int("bs-tuners", epg.DefaultTuners[epg.BS], "number of BS tuners")
+)
+
+func init() {
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintln(out, "usage: atqh [options] [day]")
+		fmt.Fprintln(out, "       atqh [options] rm <id|glob>...")
+		fmt.Fprintln(out, "       atqh [options] show <id>")
+		fmt.Fprintln(out, "       atqh [options] move <id> <HHMM|MMDDHHMM|YYYYMMDDHHMM> [duration]")
+		fmt.Fprintln(out, "       atqh [options] conflicts")
+		flag.PrintDefaults()
+	}
+}
 
 func main() {
 	flag.Parse()
-	ch := make(chan string, MaxAtCommand)
-	atqReader(ch)
-	bookingCh := make(chan booking, MaxAtCommand)
-	go func() {
-		defer close(bookingCh)
-		for line := range ch {
-			atReader(line, bookingCh)
-		}
-	}()
-
-	bookingList := []booking{}
-	for b := range bookingCh {
-		bookingList = append(bookingList, b)
+	switch flag.Arg(0) {
+	case "rm":
+		runRm(flag.Args()[1:])
+		return
+	case "show":
+		runShow(flag.Args()[1:])
+		return
+	case "move":
+		runMove(flag.Args()[1:])
+		return
+	case "conflicts":
+		runConflicts(flag.Args()[1:])
+		return
 	}
+	bookingList := flagFilter().apply(readBookings())
 	if !*option {
 		sort.Sort(byDatetime(bookingList))
 	} else {
 		sort.Sort(byID(bookingList))
 	}
-	if flag.NArg() == 0 {
-		for _, b := range bookingList {
-			fmt.Printf("%v %v %v\n", b.id, b.datetime.Format(time.ANSIC), b.filename)
-		}
-	} else {
+	if flag.NArg() > 0 {
 		day, err := strconv.Atoi(flag.Arg(0))
 		if err != nil {
 			log.Fatalf("[main] failed to convert string: %v", err)
@@ -82,12 +146,53 @@ func main() {
 		if day < 0 || day > 31 {
 			log.Fatalf("[main] day should be 0-31: %v", err)
 		}
+		filtered := []booking{}
 		for _, b := range bookingList {
 			if b.datetime.Day() == day {
-				fmt.Printf("%v %v %v\n", b.id, b.datetime.Format(time.ANSIC), b.filename)
+				filtered = append(filtered, b)
 			}
 		}
+		bookingList = filtered
+	}
+	if err := writeBookings(os.Stdout, *format, bookingList); err != nil {
+		log.Fatalf("[main] %v", err)
+	}
+}
+
+// flagFilter returns the filter given in the flags.
+func flagFilter() *filter {
+	f, err := newFilter(*from, *to, *channel, *title, *overlap, time.Now())
+	if err != nil {
+		log.Fatalf("[main] %v", err)
+	}
+	return f
+}
+
+// Read bookings from the scheduler given in the flag.
+func readBookings() []booking {
+	bookingList, err := newBookingReader().Read()
+	if err != nil {
+		log.Fatalf("[main] %v", err)
+	}
+	return bookingList
+}
+
+// Read bookings with `atq` and `at -c` commands.
+func execReadBookings() []booking {
+	ch := make(chan string, MaxAtCommand)
+	atqReader(ch)
+	bookingCh := make(chan booking, MaxAtCommand)
+	go func() {
+		defer close(bookingCh)
+		for line := range ch {
+			atReader(line, bookingCh)
+		}
+	}()
+	bookingList := []booking{}
+	for b := range bookingCh {
+		bookingList = append(bookingList, b)
 	}
+	return bookingList
 }
 
 // Read lines from `atq` command and pass the lines into channel.
@@ -131,36 +236,33 @@ func atReader(line string, ch chan<- booking) {
 		log.Fatalf("[at] failed to start: %v\n", err)
 	}
 
-	reader := bufio.NewReader(stdout)
-	for {
-		l, err := reader.ReadString('\n')
-		if err == io.EOF {
-			break
-		}
-		if !strings.HasPrefix(l, "recpt1") {
-			continue
-		}
-		// eg. "recpt1 --b25 --sid hd --strip 26 300 20180115T0730-ピタゴラスイッチ.ts"
-		recpt1Command := strings.SplitN(l, " ", 8)
-		if len(recpt1Command) < 8 {
-			log.Printf("[at] invalid line: %s\n", l)
-			continue
-		}
-		filename := strings.TrimSpace(recpt1Command[7])
-
-		datetime, err := time.Parse("2006Jan2 15:04:05",
-			fmt.Sprintf("%v%v%v %v", fields[5], fields[2], fields[3], fields[4]))
-		if err != nil {
-			log.Fatalf("[atReader] failed to parse time: %v", err)
-		}
-		b := booking{
-			id:       id,
-			datetime: datetime,
-			filename: filename,
-		}
+	datetime, err := time.ParseInLocation("2006Jan2 15:04:05",
+		fmt.Sprintf("%v%v%v %v", fields[5], fields[2], fields[3], fields[4]), time.Local)
+	if err != nil {
+		log.Fatalf("[atReader] failed to parse time: %v", err)
+	}
+	for _, b := range parseAtScript(id, datetime, stdout) {
 		ch <- b
 	}
 	if err = at.Wait(); err != nil {
 		log.Fatalf("[at] failed to wait: %v\n", err)
 	}
 }
+
+// Read jobs from the scheduler other than at, such as systemd timers.
+func schedulerReadBookings(name string) []booking {
+	s, err := bk.NewScheduler(name)
+	if err != nil {
+		log.Fatalf("[scheduler] %v\n", err)
+	}
+	jobs, err := s.List()
+	if err != nil {
+		log.Fatalf("[scheduler] failed to list jobs: %v\n", err)
+	}
+	bookingList := []booking{}
+	for _, j := range jobs {
+		b := newBooking(j.ID, j.Start, j.Program.Filename(), j.Program.Recpt1Cmd())
+		bookingList = append(bookingList, b)
+	}
+	return bookingList
+}
@@ -0,0 +1,145 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// DefaultSpoolDir is the directory where atd keeps the jobs on Debian.
+const DefaultSpoolDir = "/var/spool/cron/atjobs"
+
+// bookingReader reads the booking list.
+type bookingReader interface {
+	Read() ([]booking, error)
+}
+
+// newBookingReader returns bookingReader for the flags.
+func newBookingReader() bookingReader {
+	if *scheduler != "at" {
+		return schedulerBookingReader(*scheduler)
+	}
+	switch *atSource {
+	case "spool":
+		return spoolReader(*spool)
+	case "exec":
+		return execReader{}
+	}
+	return fallbackReader{spoolReader(*spool), execReader{}}
+}
+
+// execReader reads at jobs with `atq` and `at -c` commands.
+type execReader struct{}
+
+func (execReader) Read() ([]booking, error) {
+	return execReadBookings(), nil
+}
+
+// schedulerBookingReader reads jobs from the named scheduler.
+type schedulerBookingReader string
+
+func (s schedulerBookingReader) Read() ([]booking, error) {
+	return schedulerReadBookings(string(s)), nil
+}
+
+// fallbackReader returns the result of the first reader without error.
+type fallbackReader []bookingReader
+
+func (f fallbackReader) Read() ([]booking, error) {
+	var err error
+	for _, r := range f {
+		var bookingList []booking
+		if bookingList, err = r.Read(); err == nil {
+			return bookingList, nil
+		}
+	}
+	return nil, err
+}
+
+// spoolReader reads at jobs from the files in the atd spool directory.
+type spoolReader string
+
+// spoolFileRegexp matches the job file in the spool directory, which is named
+// after the queue, the job number and the minutes since epoch in hex.
+// eg. "a0000c018187e6"
+var spoolFileRegexp = regexp.MustCompile(`^([a-zA-Z=])([0-9a-f]{5})([0-9a-f]{8})$`)
+
+func (s spoolReader) Read() ([]booking, error) {
+	infos, err := ioutil.ReadDir(string(s))
+	if err != nil {
+		return nil, err
+	}
+	bookingList := []booking{}
+	for _, info := range infos {
+		m := spoolFileRegexp.FindStringSubmatch(info.Name())
+		if m == nil || info.IsDir() {
+			continue
+		}
+		id, err := strconv.ParseInt(m[2], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		minutes, err := strconv.ParseInt(m[3], 16, 64)
+		if err != nil {
+			return nil, err
+		}
+		datetime := time.Unix(minutes*60, 0).In(time.Local)
+		f, err := os.Open(filepath.Join(string(s), info.Name()))
+		if err != nil {
+			return nil, err
+		}
+		bookingList = append(bookingList, parseAtScript(strconv.FormatInt(id, 10), datetime, f)...)
+		f.Close()
+	}
+	return bookingList, nil
+}
+
+// parseAtScript extracts recpt1 commands from the script of the at job with
+// the id running at datetime.
+func parseAtScript(id string, datetime time.Time, r io.Reader) []booking {
+	bookingList := []booking{}
+	reader := bufio.NewReader(r)
+	for {
+		l, err := reader.ReadString('\n')
+		if err == io.EOF {
+			break
+		}
+		if !strings.HasPrefix(l, "recpt1") {
+			continue
+		}
+		// eg. "recpt1 --b25 --sid hd --strip 26 300 20180115T0730-ピタゴラスイッチ.ts"
+		command := strings.TrimSpace(l)
+		p, err := epg.ParseRecpt1Cmd(command, datetime)
+		if err != nil {
+			log.Printf("[at] invalid line: %s\n", command)
+			continue
+		}
+		// the filename follows the options, the channel and the duration.
+		filename := strings.Join(strings.Fields(command)[len(p.Options)+3:], " ")
+		bookingList = append(bookingList, newBooking(id, datetime, filename, command))
+	}
+	return bookingList
+}
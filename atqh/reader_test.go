@@ -0,0 +1,86 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_spoolReader(t *testing.T) {
+	bookingList, err := spoolReader(filepath.Join("testdata", "atjobs")).Read()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	sort.Sort(byID(bookingList))
+	want := []struct {
+		id       string
+		datetime time.Time
+		filename string
+		duration time.Duration
+	}{
+		{"18", time.Date(2018, 1, 14, 22, 30, 0, 0, time.UTC), "20180115T0730-ピタゴラスイッチ.ts", 5 * time.Minute},
+		{"26", time.Date(2018, 1, 15, 12, 0, 0, 0, time.UTC), "20180115T2100-ドキュメンタリー 世界の車窓から.ts", time.Hour},
+	}
+	if len(bookingList) != len(want) {
+		t.Fatalf("want: %d bookings, out: %d", len(want), len(bookingList))
+	}
+	for i, w := range want {
+		b := bookingList[i]
+		if b.id != w.id || !b.datetime.Equal(w.datetime) || b.filename != w.filename || b.duration != w.duration {
+			t.Fatalf("want: %s %s %s %s, out: %s %s %s %s",
+				w.id, w.datetime, w.filename, w.duration, b.id, b.datetime, b.filename, b.duration)
+		}
+	}
+}
+
+func Test_fallbackReader(t *testing.T) {
+	r := fallbackReader{spoolReader(filepath.Join("testdata", "missing")), spoolReader(filepath.Join("testdata", "atjobs"))}
+	bookingList, err := r.Read()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(bookingList) != 2 {
+		t.Fatalf("want: 2 bookings, out: %d", len(bookingList))
+	}
+}
+
+func Test_parseAtScript(t *testing.T) {
+	start := time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local)
+	cases := []struct {
+		line     string
+		filename string
+		duration time.Duration
+	}{
+		{"recpt1 --b25 --sid hd --strip 26 300 20180115T0730-ピタゴラスイッチ.ts", "20180115T0730-ピタゴラスイッチ.ts", 5 * time.Minute},
+		{"recpt1 --b25 --device /dev/pt3video1 --strip 26 900 20180115T0730-ピタゴラスイッチ.ts", "20180115T0730-ピタゴラスイッチ.ts", 15 * time.Minute},
+		{"recpt1 --b25 --strip 26 900 x.ts", "x.ts", 15 * time.Minute},
+		{"recpt1 --b25 --strip 26 3600 20180115T0730-世界の車窓から 特別編.ts", "20180115T0730-世界の車窓から 特別編.ts", time.Hour},
+	}
+	for _, c := range cases {
+		script := "#!/bin/sh\ncd /home/pi/recorded || exit 1\n" + c.line + "\n"
+		bookingList := parseAtScript("12", start, strings.NewReader(script))
+		if len(bookingList) != 1 {
+			t.Fatalf("%s: want: 1 booking, out: %d", c.line, len(bookingList))
+		}
+		b := bookingList[0]
+		if b.filename != c.filename || b.channel != "26" || b.duration != c.duration {
+			t.Fatalf("want: %s %s %s, out: %s %s %s", c.filename, "26", c.duration, b.filename, b.channel, b.duration)
+		}
+	}
+}
@@ -16,80 +16,90 @@ package main
 
 import "regexp"
 
-func programTitleFilter() []*regexp.Regexp {
-	ptn := []string{
+// titleRule picks the programs whose title matches pattern. priority decides
+// which program to drop when recordings conflict, and the higher is kept.
+type titleRule struct {
+	pattern  *regexp.Regexp
+	priority int
+}
+
+func programTitleFilter() []titleRule {
+	ptn := []struct {
+		pattern  string
+		priority int
+	}{
 		// Seasonal
-		`.*マッサン.*`,
-		`.*半分、青い。.*`,
-		`.*カーネーション.*`,
-		`.*花子とアン.*`,
-		`.*わろてんか.*`,
-		`.*ポプテピピック.*`,
-		`.*西郷どん.*`,
+		{`.*マッサン.*`, 0},
+		{`.*半分、青い。.*`, 0},
+		{`.*カーネーション.*`, 0},
+		{`.*花子とアン.*`, 0},
+		{`.*わろてんか.*`, 0},
+		{`.*ポプテピピック.*`, 0},
+		{`.*西郷どん.*`, 0},
 		// Weekdays
-		`.*デザインあ.*`,
-		`.*ピタゴラスイッチ.*`,
-		`.*Eテレ0655.*`,
-		`.*Eテレ2355.*`,
-		`.*地球ドラマチック.*`,
-		`.*BS世界のドキュメンタリー.*`,
-		`.*クローズアップ現代.*`,
-		`.*日経プラス10.*`,
+		{`.*デザインあ.*`, 0},
+		{`.*ピタゴラスイッチ.*`, 0},
+		{`.*Eテレ0655.*`, 0},
+		{`.*Eテレ2355.*`, 0},
+		{`.*地球ドラマチック.*`, 0},
+		{`.*BS世界のドキュメンタリー.*`, 0},
+		{`.*クローズアップ現代.*`, 0},
+		{`.*日経プラス10.*`, 0},
 		// Weekly
-		`.*ねほりんぱほりん.*`,
-		`.*旅するスペイン語.*`,
-		`.*タモリ倶楽部.*`,
-		`.*ブラタモリ.*`,
-		`.*鉄腕.*`,
-		`.*ドキュメント72時間.*`,
-		`.*ルパン三世.*`,
-		`.*ゴッドタン.*`,
-		`.*3月のライオン.*`,
-		`.*ピアノの森.*`,
-		`.*植物男子.*`,
-		`.*プロフェッショナル　仕事の流儀.*`,
-		`.*オイコノミア.*`,
-		`.*日本の話芸.*`,
-		`.*所さんの目がテン.*`,
-		`.*NHKスペシャル.*`,
-		`.*世界ふしぎ発見.*`,
-		`.*探偵\!ナイトスクープ.*`,
-		`.*世界仰天ニュース.*`,
-		`.*水曜どうでしょう.*`,
-		`.*マツコの知らない世界.*`,
-		`.*超入門！落語　THE　MOVIE.*`,
-		`.*探検バクモン.*`,
-		`.*日本の話芸.*`,
-		`.*超AI入門.*`,
-		`.*世界史.*`,
-		`.*日本史.*`,
-		`.*地理.*`,
-		`.*ビジネス基礎.*`,
-		`.*家庭総合.*`,
-		`.*社会と情報.*`,
-		`.*簿記.*`,
-		`.*将棋.*`,
-		`.*サラメシ.*`,
+		{`.*ねほりんぱほりん.*`, 0},
+		{`.*旅するスペイン語.*`, 0},
+		{`.*タモリ倶楽部.*`, 0},
+		{`.*ブラタモリ.*`, 0},
+		{`.*鉄腕.*`, 0},
+		{`.*ドキュメント72時間.*`, 0},
+		{`.*ルパン三世.*`, 0},
+		{`.*ゴッドタン.*`, 0},
+		{`.*3月のライオン.*`, 0},
+		{`.*ピアノの森.*`, 0},
+		{`.*植物男子.*`, 0},
+		{`.*プロフェッショナル　仕事の流儀.*`, 0},
+		{`.*オイコノミア.*`, 0},
+		{`.*日本の話芸.*`, 0},
+		{`.*所さんの目がテン.*`, 0},
+		{`.*NHKスペシャル.*`, 0},
+		{`.*世界ふしぎ発見.*`, 0},
+		{`.*探偵\!ナイトスクープ.*`, 0},
+		{`.*世界仰天ニュース.*`, 0},
+		{`.*水曜どうでしょう.*`, 0},
+		{`.*マツコの知らない世界.*`, 0},
+		{`.*超入門！落語　THE　MOVIE.*`, 0},
+		{`.*探検バクモン.*`, 0},
+		{`.*日本の話芸.*`, 0},
+		{`.*超AI入門.*`, 0},
+		{`.*世界史.*`, 0},
+		{`.*日本史.*`, 0},
+		{`.*地理.*`, 0},
+		{`.*ビジネス基礎.*`, 0},
+		{`.*家庭総合.*`, 0},
+		{`.*社会と情報.*`, 0},
+		{`.*簿記.*`, 0},
+		{`.*将棋.*`, 0},
+		{`.*サラメシ.*`, 0},
 		// Irregular
-		`.*ぼくらはマンガで強くなった.*`,
-		`.*BS1スペシャル.*`,
-		`.*新日本風土記.*`,
-		`.*落語研究会.*`,
-		`.*ATPテニス.*`,
-		`.*ウィンブルドン.*`,
-		`.*Why！？プログラミング.*`,
-		`.*カガクノミカタ.*`,
-		`.*ウルトラ重機.*`,
-		`.*MR\. BEAN.*`,
-		`.*アメトーーク！.*`,
-		`.*奇跡体験！アンビリバボー.*`,
-		`.*ダーウィンが来た.*`,
-		`.*バキ.*`,
-		`.*バカボンのパパ.*`,
+		{`.*ぼくらはマンガで強くなった.*`, 0},
+		{`.*BS1スペシャル.*`, 0},
+		{`.*新日本風土記.*`, 0},
+		{`.*落語研究会.*`, 0},
+		{`.*ATPテニス.*`, 0},
+		{`.*ウィンブルドン.*`, 0},
+		{`.*Why！？プログラミング.*`, 0},
+		{`.*カガクノミカタ.*`, 0},
+		{`.*ウルトラ重機.*`, 0},
+		{`.*MR\. BEAN.*`, 0},
+		{`.*アメトーーク！.*`, 0},
+		{`.*奇跡体験！アンビリバボー.*`, 0},
+		{`.*ダーウィンが来た.*`, 0},
+		{`.*バキ.*`, 0},
+		{`.*バカボンのパパ.*`, 0},
 	}
-	ret := []*regexp.Regexp{}
+	ret := []titleRule{}
 	for _, p := range ptn {
-		ret = append(ret, regexp.MustCompile(p))
+		ret = append(ret, titleRule{regexp.MustCompile(p.pattern), p.priority})
 	}
 	return ret
 }
@@ -24,6 +24,8 @@ import (
 	"time"
 
 	"github.com/tebeka/selenium"
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
 )
 
 const (
@@ -46,7 +48,11 @@ func findChromeDriver() string {
 }
 
 var (
-	mode = flag.String("mode", "server", "option for run mode. 'server' or 'standalone' is available.")
+	mode      = flag.String("mode", "server", "option for run mode. 'server' or 'standalone' is available.")
+	storePath = flag.String("store", booking.DefaultStoreFile, "path to the booking store file")
+	grTuners  = flag.Int("gr-tuners", epg.DefaultTuners[epg.Terrestrial], "number of terrestrial tuners")
+	bsTuners  = flag.Int("bs-tuners", epg.DefaultTuners[epg.BS], "number of BS tuners")
+	scheduler = flag.String("scheduler", booking.DefaultScheduler, "scheduler to book programs. 'at', 'systemd', 'systemd-user' or 'recorder' is available.")
 )
 
 func main() {
@@ -54,14 +60,24 @@ func main() {
 
 	batchT := time.NewTicker(batchInterval)
 	purgeT := time.NewTicker(purgeInterval)
-	m := NewManager()
+	store, err := booking.Open(*storePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	sched, err := booking.NewScheduler(*scheduler)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	m := NewManager(store, sched)
 	batch(m, *mode)
 	for {
 		select {
 		case <-batchT.C:
 			batch(m, *mode)
 		case <-purgeT.C:
-			m.Purge()
+			if err := m.Purge(); err != nil {
+				log.Println(err)
+			}
 		}
 	}
 }
@@ -101,32 +117,46 @@ func batch(m *Manager, mode string) {
 	<-done // TDMB
 	<-done // BS
 
-	now := time.Now().Format(FilePrefixFormat)
+	now := time.Now().Format(epg.FilePrefixFormat)
 
 	file, err := os.Create(now + ".log")
 	if err != nil {
 		log.Println(err)
 	}
+	pages := []*Page{}
 	for r := range ch {
 		p, err := getDetailedPage(wd, r.URL)
 		if err != nil {
 			fmt.Println(err)
+			continue
 		}
-		if !m.IsRegistered(p.ID) {
-			switch mode {
-			case "server":
-				p.Book()
-				if file != nil {
-					fmt.Fprintf(file, "Job ID: %v -> %v %v (%v ~ %v)\n", p.AtID, p.Title, p.Provider, p.Start, p.End)
-				}
-				m.Add(p)
-				time.Sleep(5 * time.Second)
-			case "standalone":
-				command := p.Dump()
-				if _, err := file.WriteString(command); err != nil {
-					fmt.Println(err)
-				}
-				time.Sleep(5 * time.Second)
+		p.Priority = r.Priority
+		if !m.IsRegistered(p) {
+			pages = append(pages, p)
+			time.Sleep(5 * time.Second)
+		}
+	}
+	tuners := epg.Tuners{
+		epg.Terrestrial: *grTuners,
+		epg.BS:          *bsTuners,
+	}
+	for _, p := range m.ResolveConflicts(pages, tuners) {
+		switch mode {
+		case "server":
+			if err := p.Book(m.sched); err != nil {
+				log.Println(err)
+				continue
+			}
+			if file != nil {
+				fmt.Fprintf(file, "Job ID: %v -> %v %v (%v ~ %v)\n", p.JobID, p.Title, p.Provider, p.Start, p.End)
+			}
+			if err := m.Add(p); err != nil {
+				log.Println(err)
+			}
+		case "standalone":
+			command := p.Dump(m.sched)
+			if _, err := file.WriteString(command); err != nil {
+				fmt.Println(err)
 			}
 		}
 	}
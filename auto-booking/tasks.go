@@ -21,6 +21,7 @@ import (
 	"time"
 
 	"github.com/tebeka/selenium"
+	"github.com/ymotongpoo/toolbox/epg"
 )
 
 const Timeout = 20 * time.Second
@@ -52,14 +53,16 @@ func WaitForXPath(xpath string) selenium.Condition {
 	return cond
 }
 
-func filterProgramWithTitle(r Result) bool {
-	patterns := programTitleFilter()
-	for _, p := range patterns {
-		if p.MatchString(r.Title) {
-			return true
+// filterProgramWithTitle returns the highest priority of the rules matching
+// the title of r, and false if no rule matches.
+func filterProgramWithTitle(r Result) (int, bool) {
+	priority, found := 0, false
+	for _, rule := range programTitleFilter() {
+		if rule.pattern.MatchString(r.Title) && (!found || rule.priority > priority) {
+			priority, found = rule.priority, true
 		}
 	}
-	return false
+	return priority, found
 }
 
 // fetchProgramsOn get all the URLs to the program detail pages and iss link title on a program list.
@@ -86,7 +89,8 @@ func fetchProgramsOn(wd selenium.WebDriver, url string, ch chan<- Result) error
 			fmt.Printf("text error: %s\n", err)
 		}
 		r := NewResult(url, title)
-		if filterProgramWithTitle(r) {
+		if priority, ok := filterProgramWithTitle(r); ok {
+			r.Priority = priority
 			ch <- r
 		}
 	}
@@ -144,7 +148,7 @@ func getDetailedPage(wd selenium.WebDriver, url string) (*Page, error) {
 	if err != nil {
 		return nil, err
 	}
-	title = replaceChar(title)
+	title = strings.TrimSpace(title)
 	elem, err = wd.FindElement(selenium.ByXPATH, DetailedPageTime)
 	if err != nil {
 		return nil, err
@@ -164,14 +168,6 @@ func getDetailedPage(wd selenium.WebDriver, url string) (*Page, error) {
 	if err != nil {
 		return nil, err
 	}
-	p := ProviderMap[provider]
+	p := epg.ProviderMap[provider]
 	return NewPage(url, title, p, t)
 }
-
-func replaceChar(s string) string {
-	s = strings.TrimSpace(s)
-	for k, v := range ReplaceCharMap {
-		s = strings.Replace(s, k, v, -1)
-	}
-	return s
-}
@@ -15,21 +15,22 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"log"
-	"os/exec"
 	"path/filepath"
 	"regexp"
 	"strconv"
-	"strings"
 	"time"
+
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
 )
 
 type Result struct {
 	URL   string
 	Title string
+	// Priority is the one of the title rule picking the program.
+	Priority int
 }
 
 func NewResult(url, title string) Result {
@@ -39,122 +40,94 @@ func NewResult(url, title string) Result {
 	}
 }
 
-type Provider string
-
 const (
-	MX     Provider = "16"
-	CX              = "21"
-	TBS             = "22"
-	TX              = "23"
-	EX              = "24"
-	NTV             = "25"
-	ETV             = "26"
-	NHK             = "27"
-	UNIV            = "28"
-	BSEX            = "BS01_0"
-	BSTBS           = "BS01_1"
-	BSNTV           = "BS13_0"
-	BSCX            = "BS13_1"
-	BSJPN           = "BS01_2"
-	NHKBS1          = "BS15_0"
-	NHKBS2          = "BS03_1"
-	BS11            = "BS09_0"
-	BS12            = "BS09_2"
+	pergeTargetLine = -4 * 24 * time.Hour
 )
 
-var ProviderMap = map[string]Provider{
-	"NHK総合1・東京":  NHK,
-	"NHKEテレ1東京":  ETV,
-	"日テレ1":       NTV,
-	"テレビ朝日":      EX,
-	"TBS1":       TBS,
-	"テレビ東京1":     TX,
-	"フジテレビ":      CX,
-	"TOKYO　MX1":  MX,
-	"放送大学1":      UNIV,
-	"NHKBS1":     NHKBS1,
-	"NHKBSプレミアム": NHKBS2,
-	"BS日テレ":      BSNTV,
-	"BS朝日1":      BSEX,
-	"BS-TBS":     BSTBS,
-	"BSジャパン":     BSJPN,
-	"BSフジ・181":   BSCX,
-	"BS11イレブン":   BS11,
-	"BS12トゥエルビ":  BS12,
+// Manager keeps booked programs in the persistent store so that they
+// survive restarts.
+type Manager struct {
+	store *booking.Store
+	sched booking.Scheduler
 }
 
-var ReplaceCharMap = map[string]string{
-	"/": "／",
-	" ": "_",
-	"<": "＜",
-	">": "＞",
-	"?": "？",
-	"(": "（",
-	")": "）",
-	"#": "＃",
-	"*": "＊",
-	"$": "＄",
-	"&": "＆",
-	"^": "＾",
-	"!": "！",
-	"@": "＠",
-	"%": "％",
-	"+": "＋",
+func NewManager(store *booking.Store, sched booking.Scheduler) *Manager {
+	return &Manager{
+		store: store,
+		sched: sched,
+	}
 }
 
-const (
-	FilePrefixFormat = "20060102T1504"
-	AtCmdFormat      = "0601021504.05"
-	pergeTargetLine  = -4 * 24 * time.Hour
-)
+// IsRegistered checks if the program p is already registered.
+func (m *Manager) IsRegistered(p *Page) bool {
+	return m.store.IsBooked(p.Entry().Key())
+}
 
-type Manager struct {
-	programs []*Page
+// Add records Page in the store.
+func (m *Manager) Add(p *Page) error {
+	return m.store.Add(p.Entry())
 }
 
-func NewManager() *Manager {
-	programs := []*Page{}
-	return &Manager{
-		programs: programs,
+// ResolveConflicts drops the pages already booked, including the jobs booked
+// by others such as gguide or by hand, and the pages which can't be recorded
+// with the tuners because of the booked programs or the other pages, and
+// returns the rest.
+func (m *Manager) ResolveConflicts(pages []*Page, tuners epg.Tuners) []*Page {
+	booked, err := booking.BookedPrograms(m.sched, m.store)
+	if err != nil {
+		log.Printf("couldn't read booked jobs: %v", err)
+	}
+	cs := []*epg.Candidate{}
+	for _, p := range booked {
+		cs = append(cs, &epg.Candidate{Program: p, Booked: true})
 	}
+	byProgram := map[*epg.Program]*Page{}
+	seen := []*epg.Program{}
+	for _, p := range pages {
+		if contains(booked, &p.Program) || contains(seen, &p.Program) {
+			continue
+		}
+		seen = append(seen, &p.Program)
+		cs = append(cs, &epg.Candidate{Program: &p.Program, Priority: p.Priority})
+		byProgram[&p.Program] = p
+	}
+	accepted, dropped := epg.Schedule(cs, tuners)
+	for _, c := range dropped {
+		log.Printf("dropped (%s tuners are busy): %v %v (%v ~ %v)", c.Provider.Band(), c.Title, c.Provider, c.Start, c.End)
+	}
+	ret := []*Page{}
+	for _, c := range accepted {
+		if p, ok := byProgram[c.Program]; ok {
+			ret = append(ret, p)
+		}
+	}
+	return ret
 }
 
-// IsRegistered checks if the program with the ID is already registered.
-func (m *Manager) IsRegistered(id string) bool {
-	for _, p := range m.programs {
-		if p.ID == id {
+// contains returns true if p is in ps. Programs are compared by the channel
+// and the start time since the jobs in the scheduler have no URL.
+func contains(ps []*epg.Program, p *epg.Program) bool {
+	for _, bp := range ps {
+		if bp.Provider == p.Provider && bp.Start.Equal(p.Start) {
 			return true
 		}
 	}
 	return false
 }
 
-// Add appends Page in programs field.
-func (m *Manager) Add(p *Page) {
-	m.programs = append(m.programs, p)
-}
-
-// Purge deletss obsolete data stored in programs field.
-func (m *Manager) Purge() {
+// Purge deletss obsolete data stored in the store.
+func (m *Manager) Purge() error {
 	deadline := time.Now().Add(pergeTargetLine)
-	purged := []*Page{}
-	for _, p := range m.programs {
-		if p.End.After(deadline) {
-			purged = append(purged, p)
-		}
-	}
-	m.programs = purged
+	return m.store.Purge(deadline)
 }
 
-// Page is a struct to hold TV program metadata and at Job ID.
+// Page is a struct to hold TV program metadata and the scheduler job ID.
 type Page struct {
-	ID       string
-	URL      string
-	Title    string
-	Provider Provider
-	Start    time.Time
-	End      time.Time
-	AtID     int
+	epg.Program
+	ID    string
+	JobID string
+	// Priority is used to resolve conflicts with the other pages.
+	Priority int
 }
 
 // parseTime parse the string t in time expression and returns corresponding value in time.Time
@@ -214,7 +187,7 @@ func parseTime(t string) (time.Time, time.Time, error) {
 }
 
 // NewPage generates a detailed program metadata instance.
-func NewPage(url, title string, provider Provider, timeStr string) (*Page, error) {
+func NewPage(url, title string, provider epg.Provider, timeStr string) (*Page, error) {
 	s, e, err := parseTime(timeStr)
 	if err != nil {
 		return nil, err
@@ -222,81 +195,36 @@ func NewPage(url, title string, provider Provider, timeStr string) (*Page, error
 	id := filepath.Base(url) // expecting Yahoo! TV Guide detailed page URL.
 
 	return &Page{
-		ID:       id,
-		URL:      url,
-		Title:    title,
-		Provider: provider,
-		Start:    s,
-		End:      e,
-		AtID:     0,
+		Program: epg.Program{
+			URL:      url,
+			Title:    title,
+			Provider: provider,
+			Start:    s,
+			End:      e,
+		},
+		ID:    id,
+		JobID: "",
 	}, nil
 }
 
-// Duration returns the length of period between start time and end time in seconds.
-func (p *Page) Duration() int {
-	return int(p.End.Sub(p.Start) / time.Second)
+// Entry returns the record of p to be kept in the booking store.
+func (p *Page) Entry() *booking.Entry {
+	e := booking.NewEntry(&p.Program)
+	e.JobID = p.JobID
+	return e
 }
 
-func (p *Page) Dump() string {
-	prefix := p.Start.Format(FilePrefixFormat)
-	filename := fmt.Sprintf("%s-%s.ts", prefix, p.Title)
-	duration := strconv.Itoa(p.Duration())
-	startTime := p.Start.Format(AtCmdFormat)
-	recpt1Str := []string{"echo", "recpt1", "--b25", "--sid", "hd", "--strip", string(p.Provider), duration, filename, "|", "at", "-t", startTime, "\n"}
-	return strings.Join(recpt1Str, " ")
+// Dump returns the line of shell script to book p with the scheduler s.
+func (p *Page) Dump(s booking.Scheduler) string {
+	return s.Command(&p.Program) + "\n"
 }
 
-// Book issues recpt1 command with at command support for scheduling.
-func (p *Page) Book() {
-	prefix := p.Start.Format(FilePrefixFormat)
-	filename := fmt.Sprintf("%s-%s.ts", prefix, p.Title)
-	duration := strconv.Itoa(p.Duration())
-	recpt1Str := []string{"recpt1", "--b25", "--sid", "hd", "--strip", string(p.Provider), duration, filename}
-	recpt1Cmd := exec.Command("echo", recpt1Str...)
-	startTime := p.Start.Format(AtCmdFormat)
-	atCmd := exec.Command("at", "-t", startTime)
-
-	pr, pw := io.Pipe()
-	recpt1Cmd.Stdout = pw
-	atCmd.Stdin = pr
-	stderr, err := atCmd.StderrPipe()
-	if err != nil {
-		log.Fatalln(err)
-	}
-	err = recpt1Cmd.Start()
-	if err != nil {
-		log.Fatalf("%v\n%v\n", err, strings.Join(recpt1Str, " "))
-	}
-	err = atCmd.Start()
+// Book books the recording of p with the scheduler s and keeps the job ID.
+func (p *Page) Book(s booking.Scheduler) error {
+	id, err := s.Schedule(&p.Program)
 	if err != nil {
-		log.Fatalln(err)
-	}
-	recpt1Cmd.Wait()
-	pw.Close()
-	scanner := bufio.NewScanner(stderr)
-	for scanner.Scan() {
-		line := scanner.Text()
-		id := parseAtID(line)
-		if id != 0 {
-			p.AtID = id
-		}
-	}
-	err = atCmd.Wait()
-	if err != nil {
-		log.Fatalf("%v", err)
-	}
-}
-
-// parseAtID parse the stderr of at command and find at job ID from the output.
-func parseAtID(s string) int {
-	pattern := regexp.MustCompile(`job ([0-9]+) at (Sun|Mon|Tue|Wed|Thu|Fri|Sat) (Jan|Feb|Mar|Apr|May|Jun|Jul|Aug|Sep|Oct|Nov|Dec) \d{1,2} \d{1,2}:\d{1,2}:\d{1,2} \d{4}`)
-	m := pattern.FindStringSubmatch(s)
-	if len(m) > 1 {
-		id, err := strconv.Atoi(m[1])
-		if err != nil {
-			log.Fatalln(err)
-		}
-		return id
+		return err
 	}
-	return 0
+	p.JobID = id
+	return nil
 }
@@ -15,9 +15,15 @@
 package main
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
 )
 
 func Test_parseTime(t *testing.T) {
@@ -52,21 +58,75 @@ func Test_parseTime(t *testing.T) {
 		}
 	}
 }
-func Test_parseAtID(t *testing.T) {
-	in := []string{
-		"job 1 at Sun Nov 19 14:25:00 2017",
-		"job 24 at Sun Nov 19 21:06:00 2017",
-		"job 10773 at Fri Nov 24 14:20:00 2017",
+
+// emptyScheduler is booking.Scheduler without jobs.
+type emptyScheduler struct{}
+
+func (emptyScheduler) Schedule(p *epg.Program) (string, error) { return "", nil }
+func (emptyScheduler) List() ([]*booking.Job, error)           { return nil, nil }
+func (emptyScheduler) Cancel(id string) error                  { return nil }
+func (emptyScheduler) Command(p *epg.Program) string           { return "" }
+
+// atScheduler is booking.Scheduler with the jobs booked by others.
+type atScheduler struct {
+	emptyScheduler
+	jobs []*booking.Job
+}
+
+func (s atScheduler) List() ([]*booking.Job, error) { return s.jobs, nil }
+
+func Test_ResolveConflicts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auto-booking")
+	if err != nil {
+		t.Fatalf("error: %s", err)
 	}
-	want := []int{
-		1,
-		24,
-		10773,
+	defer os.RemoveAll(dir)
+	store, err := booking.Open(filepath.Join(dir, "booking.json"))
+	if err != nil {
+		t.Fatalf("error: %s", err)
 	}
-	for i, r := range in {
-		id := parseAtID(r)
-		if id != want[i] {
-			t.Fatalf("want: %d, out: %d", want[i], id)
+	m := NewManager(store, emptyScheduler{})
+
+	start := time.Date(2018, 1, 15, 21, 0, 0, 0, time.Local)
+	page := func(title string, provider epg.Provider, priority int) *Page {
+		return &Page{
+			Program:  epg.Program{Title: title, Provider: provider, Start: start, End: start.Add(time.Hour)},
+			Priority: priority,
 		}
 	}
+	// the page with the higher priority is kept even if it comes later.
+	pages := []*Page{page("a", "26", 0), page("b", "27", 1)}
+	out := m.ResolveConflicts(pages, epg.Tuners{epg.Terrestrial: 1})
+	if len(out) != 1 || out[0].Title != "b" {
+		t.Fatalf("want: [b], out: %v", out)
+	}
+}
+
+func Test_ResolveConflictsBooked(t *testing.T) {
+	dir, err := ioutil.TempDir("", "auto-booking")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := booking.Open(filepath.Join(dir, "booking.json"))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	start := time.Now().Add(time.Hour).Truncate(time.Minute)
+	program := func(title string, provider epg.Provider) epg.Program {
+		return epg.Program{Title: title, Provider: provider, Start: start, End: start.Add(time.Hour)}
+	}
+	// "a" is already booked by an at job without URL.
+	booked := program("a", "26")
+	m := NewManager(store, atScheduler{jobs: []*booking.Job{{ID: "1", Start: start, Program: &booked}}})
+
+	pages := []*Page{
+		{Program: program("a", "26")},
+		{Program: program("c", "27")},
+	}
+	pages[0].URL = "https://tv.yahoo.co.jp/program/1"
+	out := m.ResolveConflicts(pages, epg.Tuners{epg.Terrestrial: 2})
+	if len(out) != 1 || out[0].Title != "c" {
+		t.Fatalf("want: [c], out: %v", out)
+	}
 }
@@ -0,0 +1,137 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package booking
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// atJobPattern matches the message of at command on job submission such as
+// "job 12 at Mon Jan 15 07:30:00 2018".
+var atJobPattern = regexp.MustCompile(`job ([0-9]+) at `)
+
+// AtScheduler books recording jobs with at command.
+type AtScheduler struct{}
+
+// Schedule books the recording of p with at command, and returns the job ID.
+func (s *AtScheduler) Schedule(p *epg.Program) (string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("at", "-t", p.Start.Format(epg.AtCmdFormat))
+	cmd.Stdin = strings.NewReader(p.Recpt1Cmd() + "\n")
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("at: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	id := parseAtJobID(stderr.String())
+	if id == "" {
+		return "", fmt.Errorf("at: job ID not found: %s", strings.TrimSpace(stderr.String()))
+	}
+	return id, nil
+}
+
+// parseAtJobID finds at job ID from the output of at command, or returns
+// empty string if not found.
+func parseAtJobID(s string) string {
+	m := atJobPattern.FindStringSubmatch(s)
+	if len(m) < 2 {
+		return ""
+	}
+	return m[1]
+}
+
+// List reads the at queue with `atq` and `at -c`, and returns the jobs
+// running recpt1.
+func (s *AtScheduler) List() ([]*Job, error) {
+	out, err := exec.Command("atq").Output()
+	if err != nil {
+		return nil, fmt.Errorf("atq: %v", err)
+	}
+	jobs := []*Job{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		id, start, err := parseAtqLine(scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		script, err := exec.Command("at", "-c", id).Output()
+		if err != nil {
+			return nil, fmt.Errorf("at -c %s: %v", id, err)
+		}
+		p := findRecpt1(script, start)
+		if p == nil {
+			continue
+		}
+		jobs = append(jobs, &Job{
+			ID:      id,
+			Start:   start,
+			Program: p,
+		})
+	}
+	return jobs, scanner.Err()
+}
+
+// Cancel deletes the at job with the id.
+func (s *AtScheduler) Cancel(id string) error {
+	out, err := exec.Command("atrm", id).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("atrm %s: %v: %s", id, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Command returns the shell command line to book p with at command.
+func (s *AtScheduler) Command(p *epg.Program) string {
+	return p.Recpt1AtCmd()
+}
+
+// parseAtqLine parses a line of atq output such as
+// "12	Mon Jan 15 07:30:00 2018 a user" into job ID and start time.
+func parseAtqLine(line string) (string, time.Time, error) {
+	fields := strings.Fields(line)
+	if len(fields) < 6 {
+		return "", time.Time{}, fmt.Errorf("invalid atq line: %q", line)
+	}
+	start, err := time.ParseInLocation("Mon Jan 2 15:04:05 2006", strings.Join(fields[1:6], " "), time.Local)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("invalid atq line: %q: %v", line, err)
+	}
+	return fields[0], start, nil
+}
+
+// findRecpt1 returns the program recorded by the recpt1 command in the job
+// script, or nil if the script doesn't run recpt1.
+func findRecpt1(script []byte, start time.Time) *epg.Program {
+	scanner := bufio.NewScanner(bytes.NewReader(script))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "recpt1") {
+			continue
+		}
+		p, err := epg.ParseRecpt1Cmd(line, start)
+		if err != nil {
+			continue
+		}
+		return p
+	}
+	return nil
+}
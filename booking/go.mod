@@ -0,0 +1,7 @@
+module github.com/ymotongpoo/toolbox/booking
+
+go 1.13
+
+require github.com/ymotongpoo/toolbox/epg v0.0.0
+
+replace github.com/ymotongpoo/toolbox/epg => ../epg
@@ -0,0 +1,107 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package booking
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// DefaultRecorderAddr is the address where the recorder daemon serves its API.
+const DefaultRecorderAddr = "localhost:8090"
+
+// RecorderScheduler books recording jobs to the recorder daemon via its
+// HTTP API.
+type RecorderScheduler struct {
+	// URL is the base URL of the recorder API.
+	URL string
+}
+
+type recorderJob struct {
+	ID    string `json:"id"`
+	Entry *Entry `json:"entry"`
+	State string `json:"state"`
+}
+
+func (s *RecorderScheduler) do(method, path string, body []byte, v interface{}) error {
+	req, err := http.NewRequest(method, s.URL+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(res.Body)
+		return fmt.Errorf("recorder: %s %s: %s: %s", method, path, res.Status, bytes.TrimSpace(msg))
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// Schedule books the recording of p to the recorder and returns the job ID.
+func (s *RecorderScheduler) Schedule(p *epg.Program) (string, error) {
+	b, err := json.Marshal(NewEntry(p))
+	if err != nil {
+		return "", err
+	}
+	res := map[string]string{}
+	if err := s.do(http.MethodPost, "/bookings", b, &res); err != nil {
+		return "", err
+	}
+	return res["id"], nil
+}
+
+// List returns the jobs waiting or running in the recorder.
+func (s *RecorderScheduler) List() ([]*Job, error) {
+	rjs := []*recorderJob{}
+	if err := s.do(http.MethodGet, "/bookings", nil, &rjs); err != nil {
+		return nil, err
+	}
+	jobs := []*Job{}
+	for _, rj := range rjs {
+		if rj.Entry == nil || (rj.State != "scheduled" && rj.State != "recording") {
+			continue
+		}
+		jobs = append(jobs, &Job{
+			ID:      rj.ID,
+			Start:   rj.Entry.Start,
+			Program: rj.Entry.Program(),
+		})
+	}
+	return jobs, nil
+}
+
+// Cancel deletes the job with the id from the recorder.
+func (s *RecorderScheduler) Cancel(id string) error {
+	return s.do(http.MethodDelete, "/bookings/"+id, nil, nil)
+}
+
+// Command returns the shell command line to book p to the recorder with curl.
+func (s *RecorderScheduler) Command(p *epg.Program) string {
+	b, _ := json.Marshal(NewEntry(p))
+	return fmt.Sprintf("curl -fsS -X POST -H 'Content-Type: application/json' -d %s %s/bookings",
+		shellQuote(string(b)), s.URL)
+}
@@ -0,0 +1,87 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package booking
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// DefaultScheduler is the name of the scheduler used when not specified.
+const DefaultScheduler = "at"
+
+// Job is a recording job scheduled in the scheduler.
+type Job struct {
+	ID      string
+	Start   time.Time
+	Program *epg.Program
+}
+
+// Scheduler is the backend to run recpt1 at the start time of programs.
+type Scheduler interface {
+	// Schedule books the recording of p and returns the job ID.
+	Schedule(p *epg.Program) (string, error)
+	// List returns the recording jobs in the scheduler.
+	List() ([]*Job, error)
+	// Cancel deletes the job with the id.
+	Cancel(id string) error
+	// Command returns the shell command line to book p.
+	Command(p *epg.Program) string
+}
+
+// NewScheduler returns the scheduler with the name, "at", "systemd",
+// "systemd-user" or "recorder".
+func NewScheduler(name string) (Scheduler, error) {
+	switch name {
+	case "at":
+		return &AtScheduler{}, nil
+	case "systemd":
+		return &SystemdScheduler{}, nil
+	case "systemd-user":
+		return &SystemdScheduler{User: true}, nil
+	case "recorder":
+		return &RecorderScheduler{URL: "http://" + DefaultRecorderAddr}, nil
+	}
+	return nil, fmt.Errorf("unknown scheduler: %q", name)
+}
+
+// BookedPrograms returns the programs already booked both in the scheduler
+// sched and in the store s. The programs in s may not be listed by the
+// scheduler, e.g. when they are booked with another scheduler. The programs
+// in s are returned with the error even if the scheduler is not available.
+func BookedPrograms(sched Scheduler, s *Store) ([]*epg.Program, error) {
+	booked := []*epg.Program{}
+	seen := map[string]bool{}
+	jobs, err := sched.List()
+	for _, j := range jobs {
+		seen[slotKey(j.Program)] = true
+		booked = append(booked, j.Program)
+	}
+	now := time.Now()
+	for _, e := range s.Entries() {
+		p := e.Program()
+		if p.End.Before(now) || seen[slotKey(p)] {
+			continue
+		}
+		booked = append(booked, p)
+	}
+	return booked, err
+}
+
+func slotKey(p *epg.Program) string {
+	return fmt.Sprintf("%s|%d", p.Provider, p.Start.Unix())
+}
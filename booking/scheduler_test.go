@@ -0,0 +1,68 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package booking
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+func Test_parseAtJobID(t *testing.T) {
+	in := []string{
+		"job 1 at Sun Nov 19 14:25:00 2017",
+		"job 24 at Sun Nov 19 21:06:00 2017",
+		"warning: commands will be executed using /bin/sh\njob 10773 at Fri Nov 24 14:20:00 2017\n",
+	}
+	want := []string{
+		"1",
+		"24",
+		"10773",
+	}
+	for i, r := range in {
+		id := parseAtJobID(r)
+		if id != want[i] {
+			t.Fatalf("want: %s, out: %s", want[i], id)
+		}
+	}
+}
+
+func Test_SystemdUnit(t *testing.T) {
+	start := time.Date(2018, 1, 15, 7, 30, 0, 0, time.Local)
+	p := &epg.Program{
+		Title:    "ピタゴラスイッチ",
+		Provider: epg.ETV,
+		Start:    start,
+		End:      start.Add(5 * time.Minute),
+	}
+	name := unitName(p)
+	if name != "recpt1-20180115T0730-26" {
+		t.Fatalf("want: recpt1-20180115T0730-26, out: %s", name)
+	}
+	s, err := parseUnitName(name)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !s.Equal(start) {
+		t.Fatalf("want: %s, out: %s", start, s)
+	}
+
+	exec := "{ path=/usr/bin/recpt1 ; argv[]=recpt1 --b25 --sid hd --strip 26 300 20180115T0730-ピタゴラスイッチ.ts ; ignore_errors=no ; start_time=[n/a] ; stop_time=[n/a] ; pid=0 ; code=(null) ; status=0/0 }\n"
+	want := "recpt1 --b25 --sid hd --strip 26 300 20180115T0730-ピタゴラスイッチ.ts"
+	if out := parseExecStart(exec); out != want {
+		t.Fatalf("want: %s, out: %s", want, out)
+	}
+}
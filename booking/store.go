@@ -0,0 +1,203 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package booking keeps track of TV programs already booked for recording
+// so that they are not booked twice across runs.
+package booking
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// DefaultStoreFile is the filename of JSON file where booked programs are recorded.
+const DefaultStoreFile = "booked.json"
+
+// Entry is a record of a booked program.
+type Entry struct {
+	URL      string    `json:"url"`
+	Channel  string    `json:"channel"`
+	Title    string    `json:"title"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	JobID    string    `json:"job_id,omitempty"`
+	BookedAt time.Time `json:"booked_at"`
+	// Options are the recpt1 options of the program, or nil for the default.
+	Options []string `json:"options,omitempty"`
+}
+
+// NewEntry creates an entry for the program p.
+func NewEntry(p *epg.Program) *Entry {
+	return &Entry{
+		URL:     p.URL,
+		Channel: string(p.Provider),
+		Title:   p.Title,
+		Start:   p.Start,
+		End:     p.End,
+		Options: p.Options,
+	}
+}
+
+// Program returns the program recorded in e.
+func (e *Entry) Program() *epg.Program {
+	p := epg.Provider(e.Channel)
+	return &epg.Program{
+		URL:      e.URL,
+		Title:    e.Title,
+		Start:    e.Start,
+		End:      e.End,
+		Channel:  p.Name(),
+		Provider: p,
+		Options:  e.Options,
+	}
+}
+
+// Key returns the identifier of e in the store.
+func (e *Entry) Key() string {
+	return Key(e.URL, e.Channel, e.Start)
+}
+
+// Key generates the identifier of the program from its URL, channel and start time.
+func Key(url, channel string, start time.Time) string {
+	return fmt.Sprintf("%s|%s|%s", url, channel, start.UTC().Format(time.RFC3339))
+}
+
+// Store is the persistent set of booked programs backed by a JSON file.
+type Store struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]*Entry
+}
+
+// Open loads the store from the file in path. The file is created on the
+// first call of Add if it doesn't exist yet.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path:    path,
+		entries: map[string]*Entry{},
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := []*Entry{}
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for _, e := range entries {
+		s.entries[e.Key()] = e
+	}
+	return s, nil
+}
+
+// IsBooked checks if the program with the key is already booked.
+func (s *Store) IsBooked(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.entries[key]
+	return ok
+}
+
+// Get returns the entry with the key, or nil if it is not booked.
+func (s *Store) Get(key string) *Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key]
+}
+
+// Add records e as booked and saves the store to the file.
+func (s *Store) Add(e *Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e.BookedAt.IsZero() {
+		e.BookedAt = time.Now()
+	}
+	s.entries[e.Key()] = e
+	return s.save()
+}
+
+// Remove deletes the entry with the key and saves the store to the file.
+func (s *Store) Remove(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return s.save()
+}
+
+// Purge deletes the entries of the programs which ended before deadline.
+func (s *Store) Purge(deadline time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for k, e := range s.entries {
+		if e.End.Before(deadline) {
+			delete(s.entries, k)
+		}
+	}
+	return s.save()
+}
+
+// Entries returns all the booked entries sorted by start time.
+func (s *Store) Entries() []*Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.sorted()
+}
+
+func (s *Store) sorted() []*Entry {
+	entries := []*Entry{}
+	for _, e := range s.entries {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Start.Equal(entries[j].Start) {
+			return entries[i].Key() < entries[j].Key()
+		}
+		return entries[i].Start.Before(entries[j].Start)
+	})
+	return entries
+}
+
+// save writes entries into a temporary file and renames it to path so that
+// the store file is never left half written.
+func (s *Store) save() error {
+	b, err := json.MarshalIndent(s.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(s.path), filepath.Base(s.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), s.path)
+}
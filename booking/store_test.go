@@ -0,0 +1,86 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package booking
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Store(t *testing.T) {
+	dir, err := ioutil.TempDir("", "booking")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, DefaultStoreFile)
+
+	jst := time.FixedZone("JST", 9*60*60)
+	old := &Entry{
+		URL:     "https://www.tvkingdom.jp/schedule/101024201801150730.action",
+		Channel: "26",
+		Title:   "ピタゴラスイッチ",
+		Start:   time.Date(2018, 1, 15, 7, 30, 0, 0, jst),
+		End:     time.Date(2018, 1, 15, 7, 35, 0, 0, jst),
+		JobID:   "12",
+	}
+	cur := &Entry{
+		URL:     "https://www.tvkingdom.jp/schedule/101024201801220730.action",
+		Channel: "26",
+		Title:   "ピタゴラスイッチ",
+		Start:   time.Date(2018, 1, 22, 7, 30, 0, 0, jst),
+		End:     time.Date(2018, 1, 22, 7, 35, 0, 0, jst),
+	}
+
+	s, err := Open(path)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for _, e := range []*Entry{cur, old} {
+		if err := s.Add(e); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	key := Key(old.URL, old.Channel, old.Start.UTC())
+	if !s.IsBooked(key) {
+		t.Fatalf("want: %s is booked, out: not booked", key)
+	}
+	if e := s.Get(key); e == nil || e.JobID != "12" {
+		t.Fatalf("want: job 12, out: %v", e)
+	}
+	entries := s.Entries()
+	if len(entries) != 2 || entries[0].Key() != old.Key() {
+		t.Fatalf("want: %s first, out: %v", old.Key(), entries)
+	}
+
+	if err := s.Purge(time.Date(2018, 1, 20, 0, 0, 0, 0, jst)); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	s, err = Open(path)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if s.IsBooked(old.Key()) || !s.IsBooked(cur.Key()) {
+		t.Fatalf("want: only %s, out: %v", cur.Key(), s.Entries())
+	}
+}
@@ -0,0 +1,174 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package booking
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+const (
+	// unitPrefix is the prefix of the transient units for recordings.
+	unitPrefix = "recpt1-"
+
+	// calendarFormat is the format of OnCalendar= timer property.
+	calendarFormat = "2006-01-02 15:04:05"
+)
+
+// SystemdScheduler books recording jobs as transient systemd timers with
+// systemd-run, so that journald keeps the log and the exit status of every
+// recording.
+type SystemdScheduler struct {
+	// User makes the timers run in the user service manager.
+	User bool
+}
+
+// unitName returns the name of the transient unit to record p. The start time
+// and the provider in the name keep it unique and let List recover the start
+// time.
+func unitName(p *epg.Program) string {
+	return unitPrefix + p.Start.In(time.Local).Format(epg.FilePrefixFormat) + "-" + string(p.Provider)
+}
+
+func (s *SystemdScheduler) runArgs(p *epg.Program) []string {
+	args := []string{}
+	if s.User {
+		args = append(args, "--user")
+	}
+	args = append(args,
+		"--unit="+unitName(p),
+		"--description="+epg.SanitizeTitle(p.Title),
+		"--on-calendar="+p.Start.In(time.Local).Format(calendarFormat),
+		"--timer-property=AccuracySec=1s",
+	)
+	if cwd, err := os.Getwd(); err == nil {
+		args = append(args, "--property=WorkingDirectory="+cwd)
+	}
+	args = append(args, "recpt1")
+	return append(args, p.Recpt1Args()...)
+}
+
+func (s *SystemdScheduler) systemctl(args ...string) *exec.Cmd {
+	if s.User {
+		args = append([]string{"--user"}, args...)
+	}
+	return exec.Command("systemctl", args...)
+}
+
+// Schedule books the recording of p with systemd-run, and returns the unit
+// name as the job ID.
+func (s *SystemdScheduler) Schedule(p *epg.Program) (string, error) {
+	out, err := exec.Command("systemd-run", s.runArgs(p)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("systemd-run: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return unitName(p), nil
+}
+
+// List returns the recording jobs in the transient timers.
+func (s *SystemdScheduler) List() ([]*Job, error) {
+	out, err := s.systemctl("list-units", "--type=timer", "--all", "--no-legend", "--plain", unitPrefix+"*").Output()
+	if err != nil {
+		return nil, fmt.Errorf("systemctl list-units: %v", err)
+	}
+	jobs := []*Job{}
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		id := strings.TrimSuffix(fields[0], ".timer")
+		start, err := parseUnitName(id)
+		if err != nil {
+			continue
+		}
+		exe, err := s.systemctl("show", "--property=ExecStart", "--value", id+".service").Output()
+		if err != nil {
+			return nil, fmt.Errorf("systemctl show %s: %v", id, err)
+		}
+		p, err := epg.ParseRecpt1Cmd(parseExecStart(string(exe)), start)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, &Job{
+			ID:      id,
+			Start:   start,
+			Program: p,
+		})
+	}
+	return jobs, scanner.Err()
+}
+
+// Cancel stops the timer with the id so that the transient units are removed.
+func (s *SystemdScheduler) Cancel(id string) error {
+	out, err := s.systemctl("stop", id+".timer").CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("systemctl stop %s: %v: %s", id, err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// Command returns the shell command line to book p with systemd-run.
+func (s *SystemdScheduler) Command(p *epg.Program) string {
+	args := []string{"systemd-run"}
+	for _, a := range s.runArgs(p) {
+		args = append(args, shellQuote(a))
+	}
+	return strings.Join(args, " ")
+}
+
+// parseUnitName returns the start time embedded in the unit name by unitName.
+func parseUnitName(name string) (time.Time, error) {
+	if !strings.HasPrefix(name, unitPrefix) || len(name) < len(unitPrefix)+len(epg.FilePrefixFormat) {
+		return time.Time{}, fmt.Errorf("not a recording unit: %q", name)
+	}
+	s := name[len(unitPrefix) : len(unitPrefix)+len(epg.FilePrefixFormat)]
+	return time.ParseInLocation(epg.FilePrefixFormat, s, time.Local)
+}
+
+// parseExecStart extracts the command line from ExecStart= property such as
+// "{ path=/usr/bin/recpt1 ; argv[]=/usr/bin/recpt1 --b25 ... ; ignore_errors=no ; ... }".
+func parseExecStart(s string) string {
+	const key = "argv[]="
+	i := strings.Index(s, key)
+	if i < 0 {
+		return ""
+	}
+	s = s[i+len(key):]
+	if j := strings.Index(s, " ;"); j >= 0 {
+		s = s[:j]
+	}
+	return strings.TrimSpace(s)
+}
+
+// shellQuote quotes s with single quotes if it contains characters special
+// to the shell.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r == '-' || r == '_' || r == '=' || r == '.' || r == '/' || r == ':' || r == ',' ||
+			('a' <= r && r <= 'z') || ('A' <= r && r <= 'Z') || ('0' <= r && r <= '9'))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
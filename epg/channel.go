@@ -0,0 +1,107 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package epg
+
+// Provider is the enum type of the TV provider. The value is the channel
+// argument passed to recpt1.
+type Provider string
+
+const (
+	MX     Provider = "16"
+	CX     Provider = "21"
+	TBS    Provider = "22"
+	TX     Provider = "23"
+	EX     Provider = "24"
+	NTV    Provider = "25"
+	ETV    Provider = "26"
+	NHK    Provider = "27"
+	UNIV   Provider = "28"
+	BSEX   Provider = "BS01_0"
+	BSTBS  Provider = "BS01_1"
+	BSNTV  Provider = "BS13_0"
+	BSCX   Provider = "BS13_1"
+	BSTX   Provider = "BS01_2"
+	NHKBS1 Provider = "BS15_0"
+	NHKBS2 Provider = "BS03_1"
+	BS11   Provider = "BS09_0"
+	BS12   Provider = "BS09_2"
+
+	// BSJPN is the former name of BSTX (BSジャパン renamed to BSテレ東 in 2018).
+	BSJPN = BSTX
+)
+
+// Channel is an entry of the channel registry.
+type Channel struct {
+	Provider Provider
+	// Name is the canonical name of the channel.
+	Name string
+	// Aliases are the names of the channel shown on EPG web sites.
+	Aliases []string
+}
+
+// Channels is the registry of all the channels available for recording.
+var Channels = []*Channel{
+	{NHK, "NHK総合", []string{"NHK総合1・東京", "ＮＨＫ総合１・東京(Ch.1)"}},
+	{ETV, "NHK Eテレ", []string{"NHKEテレ1東京", "ＮＨＫＥテレ１・東京(Ch.2)"}},
+	{NTV, "日テレ", []string{"日テレ1", "日テレ(Ch.4)"}},
+	{EX, "テレビ朝日", []string{"テレビ朝日", "テレビ朝日(Ch.5)"}},
+	{TBS, "TBS", []string{"TBS1", "ＴＢＳ(Ch.6)"}},
+	{TX, "テレビ東京", []string{"テレビ東京1", "テレビ東京(Ch.7)"}},
+	{CX, "フジテレビ", []string{"フジテレビ", "フジテレビ(Ch.8)"}},
+	{MX, "TOKYO MX", []string{"TOKYO　MX1", "ＴＯＫＹＯ　ＭＸ１(Ch.9)"}},
+	{UNIV, "放送大学", []string{"放送大学1", "放送大学１(Ch.12)"}},
+	{NHKBS1, "NHK BS1", []string{"NHKBS1", "ＮＨＫ ＢＳ１(Ch.1)"}},
+	{NHKBS2, "NHK BSプレミアム", []string{"NHKBSプレミアム", "ＮＨＫ ＢＳプレミアム(Ch.3)"}},
+	{BSNTV, "BS日テレ", []string{"BS日テレ", "ＢＳ日テレ(Ch.4)"}},
+	{BSEX, "BS朝日", []string{"BS朝日1", "ＢＳ朝日(Ch.5)"}},
+	{BSTBS, "BS-TBS", []string{"BS-TBS", "ＢＳ-ＴＢＳ(Ch.6)"}},
+	{BSTX, "BSテレ東", []string{"BSジャパン", "ＢＳテレ東(Ch.7)"}},
+	{BSCX, "BSフジ", []string{"BSフジ・181", "ＢＳフジ(Ch.8)"}},
+	{BS11, "BS11", []string{"BS11イレブン", "BS11イレブン(Ch.11)"}},
+	{BS12, "BS12", []string{"BS12トゥエルビ", "BS12 トゥエルビ(Ch.12)"}},
+}
+
+// ProviderMap is the map between the name strings and the enum values.
+var ProviderMap = map[string]Provider{}
+
+func init() {
+	for _, c := range Channels {
+		ProviderMap[c.Name] = c.Provider
+		for _, a := range c.Aliases {
+			ProviderMap[a] = c.Provider
+		}
+	}
+}
+
+// LookupChannel returns the channel registered for the provider p, or nil if
+// p is unknown.
+func LookupChannel(p Provider) *Channel {
+	for _, c := range Channels {
+		if c.Provider == p {
+			return c
+		}
+	}
+	return nil
+}
+
+// Name returns the canonical channel name of p. The provider value itself is
+// returned if p is not in the registry.
+func (p Provider) Name() string {
+	c := LookupChannel(p)
+	if c == nil {
+		return string(p)
+	}
+	return c.Name
+}
@@ -0,0 +1,3 @@
+module github.com/ymotongpoo/toolbox/epg
+
+go 1.13
@@ -0,0 +1,146 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// Package epg provides the TV program model, the channel registry, the
+// recpt1 command builder and the tuner scheduler shared by the recording tools.
+package epg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// FilePrefixFormat is the standard prefix format of the file.
+	FilePrefixFormat = "20060102T1504"
+
+	// AtCmdFormat is the format to express the datetime in `at` command.
+	AtCmdFormat = "0601021504.05"
+)
+
+// Program is the struct to hold TV program metadata.
+type Program struct {
+	URL         string
+	Title       string
+	Start       time.Time
+	End         time.Time
+	Channel     string
+	Provider    Provider
+	Summary     string
+	Description string
+	// Options are the recpt1 options given before channel. Recpt1Options
+	// are used if nil.
+	Options []string
+}
+
+func (p *Program) String() string {
+	return fmt.Sprintf("%s %s (%s - %s) %s", p.Provider, p.URL, p.Start, p.End, p.Title)
+}
+
+// Duration returns the length of period between start time and end time.
+func (p *Program) Duration() time.Duration {
+	return p.End.Sub(p.Start)
+}
+
+// Filename returns the name of the file recorded for p.
+func (p *Program) Filename() string {
+	prefix := p.Start.Format(FilePrefixFormat)
+	return fmt.Sprintf("%s-%s.ts", prefix, SanitizeTitle(p.Title))
+}
+
+// Recpt1Options are the options of recpt1 command given before channel,
+// duration and filename.
+var Recpt1Options = []string{"--b25", "--sid", "hd", "--strip"}
+
+// Recpt1Args returns the arguments of recpt1 command to record p.
+func (p *Program) Recpt1Args() []string {
+	return p.Recpt1ArgsFor(p.Duration(), p.Filename())
+}
+
+// Recpt1ArgsFor returns the arguments of recpt1 command to record the channel
+// of p for the duration d into filename.
+func (p *Program) Recpt1ArgsFor(d time.Duration, filename string) []string {
+	duration := strconv.Itoa(int(d / time.Second))
+	opts := p.Options
+	if opts == nil {
+		opts = Recpt1Options
+	}
+	args := append([]string{}, opts...)
+	return append(args, string(p.Provider), duration, filename)
+}
+
+// Recpt1Cmd generates single line recpt1 command string to record p.
+func (p *Program) Recpt1Cmd() string {
+	return strings.Join(append([]string{"recpt1"}, p.Recpt1Args()...), " ")
+}
+
+// Recpt1AtCmd generates single line command string to book recpt1 command
+// at the specified time based on the value in p.
+func (p *Program) Recpt1AtCmd() string {
+	startTime := p.Start.Format(AtCmdFormat)
+	return strings.Join([]string{"echo", p.Recpt1Cmd(), "|", "at", "-t", startTime}, " ")
+}
+
+// recpt1 options which take an argument.
+var recpt1ArgOptions = map[string]bool{
+	"--sid":    true,
+	"--device": true,
+	"--lnb":    true,
+	"--addr":   true,
+	"--port":   true,
+	"--http":   true,
+}
+
+// ParseRecpt1Cmd parses the recpt1 command line such as the one generated by
+// Recpt1Cmd, and returns the program recorded by it. start is the time when
+// the command runs. The title is the one embedded in the filename, and the
+// options are kept in Options.
+func ParseRecpt1Cmd(line string, start time.Time) (*Program, error) {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || filepath.Base(fields[0]) != "recpt1" {
+		return nil, fmt.Errorf("not a recpt1 command: %q", line)
+	}
+	i := 1
+	for i < len(fields) && strings.HasPrefix(fields[i], "-") {
+		if recpt1ArgOptions[fields[i]] {
+			i++
+		}
+		i++
+	}
+	if len(fields) < i+3 {
+		return nil, fmt.Errorf("recpt1 command needs channel, duration and filename: %q", line)
+	}
+	sec, err := strconv.Atoi(fields[i+1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration in %q: %v", line, err)
+	}
+	filename := strings.Join(fields[i+2:], " ")
+	title := strings.TrimSuffix(filepath.Base(filename), ".ts")
+	if len(title) > len(FilePrefixFormat) && title[len(FilePrefixFormat)] == '-' {
+		if _, err := time.Parse(FilePrefixFormat, title[:len(FilePrefixFormat)]); err == nil {
+			title = title[len(FilePrefixFormat)+1:]
+		}
+	}
+	return &Program{
+		Title:    title,
+		Start:    start,
+		End:      start.Add(time.Duration(sec) * time.Second),
+		Provider: Provider(fields[i]),
+		Channel:  Provider(fields[i]).Name(),
+		Options:  append([]string{}, fields[1:i]...),
+	}, nil
+}
@@ -0,0 +1,57 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package epg
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Recpt1AtCmd(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	in := []*Program{
+		{
+			Title:    "ピタゴラスイッチ",
+			Provider: ETV,
+			Start:    time.Date(2018, 1, 15, 7, 30, 0, 0, jst),
+			End:      time.Date(2018, 1, 15, 7, 35, 0, 0, jst),
+		},
+		{
+			Title:    " MR. BEAN (2) ",
+			Provider: ProviderMap["ＢＳテレ東(Ch.7)"],
+			Start:    time.Date(2018, 1, 15, 23, 50, 0, 0, jst),
+			End:      time.Date(2018, 1, 16, 0, 20, 0, 0, jst),
+		},
+	}
+	want := []string{
+		"echo recpt1 --b25 --sid hd --strip 26 300 20180115T0730-ピタゴラスイッチ.ts | at -t 1801150730.00",
+		"echo recpt1 --b25 --sid hd --strip BS01_2 1800 20180115T2350-MR._BEAN_（2）.ts | at -t 1801152350.00",
+	}
+	for i, p := range in {
+		if out := p.Recpt1AtCmd(); out != want[i] {
+			t.Fatalf("want: %s, out: %s", want[i], out)
+		}
+	}
+}
+
+func Test_ProviderMap(t *testing.T) {
+	in := []string{"BSジャパン", "ＢＳテレ東(Ch.7)", "NHK総合1・東京", "ＮＨＫ総合１・東京(Ch.1)"}
+	want := []Provider{BSTX, BSTX, NHK, NHK}
+	for i, n := range in {
+		if out := ProviderMap[n]; out != want[i] {
+			t.Fatalf("%s: want: %s, out: %s", n, want[i], out)
+		}
+	}
+}
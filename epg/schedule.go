@@ -0,0 +1,125 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package epg
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Band is the type of tuner required to receive the channel.
+type Band string
+
+const (
+	Terrestrial Band = "GR"
+	BS          Band = "BS"
+)
+
+// Band returns the tuner type required to record the provider p.
+func (p Provider) Band() Band {
+	if strings.HasPrefix(string(p), "BS") {
+		return BS
+	}
+	return Terrestrial
+}
+
+// Tuners is the number of the physical tuners for each band.
+type Tuners map[Band]int
+
+// DefaultTuners is the tuner configuration of a PT3 card.
+var DefaultTuners = Tuners{
+	Terrestrial: 2,
+	BS:          2,
+}
+
+// Candidate is a program to be scheduled with its priority.
+// Programs with higher Priority win the tuners in conflicts.
+type Candidate struct {
+	*Program
+	Priority int
+	// Booked is true if the program is already scheduled. Booked
+	// candidates are never dropped.
+	Booked bool
+}
+
+// Schedule assigns tuners to the candidates cs and returns the candidates
+// accepted and the ones dropped because of the lack of tuners. Booked
+// candidates are accepted first, then the others in order of priority and
+// start time.
+func Schedule(cs []*Candidate, tuners Tuners) ([]*Candidate, []*Candidate) {
+	sorted := make([]*Candidate, len(cs))
+	copy(sorted, cs)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Booked != b.Booked {
+			return a.Booked
+		}
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		return a.Start.Before(b.Start)
+	})
+
+	accepted := []*Candidate{}
+	dropped := []*Candidate{}
+	for _, c := range sorted {
+		band := c.Provider.Band()
+		same := []*Program{}
+		for _, a := range accepted {
+			if a.Provider.Band() == band {
+				same = append(same, a.Program)
+			}
+		}
+		if !c.Booked && MaxOverlaps(same, c.Start, c.End)+1 > tuners[band] {
+			dropped = append(dropped, c)
+			continue
+		}
+		accepted = append(accepted, c)
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return accepted[i].Start.Before(accepted[j].Start)
+	})
+	return accepted, dropped
+}
+
+// MaxOverlaps returns the maximum number of the programs in ps on air at the
+// same time within the period between start and end.
+func MaxOverlaps(ps []*Program, start, end time.Time) int {
+	points := []time.Time{start}
+	for _, p := range ps {
+		if p.Start.After(start) && p.Start.Before(end) {
+			points = append(points, p.Start)
+		}
+	}
+	max := 0
+	for _, t := range points {
+		n := 0
+		for _, p := range ps {
+			if !p.Start.After(t) && p.End.After(t) {
+				n++
+			}
+		}
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// Overlaps reports whether the programs p and q are on air at the same time.
+func (p *Program) Overlaps(q *Program) bool {
+	return p.Start.Before(q.End) && q.Start.Before(p.End)
+}
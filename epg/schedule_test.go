@@ -0,0 +1,62 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package epg
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Schedule(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	at := func(h, m int) time.Time {
+		return time.Date(2018, 1, 15, h, m, 0, 0, jst)
+	}
+	cs := []*Candidate{
+		{Program: &Program{Title: "booked", Provider: NHK, Start: at(21, 0), End: at(22, 0)}, Booked: true},
+		{Program: &Program{Title: "low", Provider: TX, Start: at(21, 30), End: at(22, 30)}, Priority: 0},
+		{Program: &Program{Title: "high", Provider: ETV, Start: at(21, 45), End: at(22, 15)}, Priority: 10},
+		{Program: &Program{Title: "after", Provider: CX, Start: at(22, 0), End: at(23, 0)}, Priority: 0},
+		{Program: &Program{Title: "bs", Provider: NHKBS1, Start: at(21, 0), End: at(23, 0)}, Priority: 0},
+	}
+	accepted, dropped := Schedule(cs, Tuners{Terrestrial: 2, BS: 1})
+	want := []string{"booked", "bs", "high", "after"}
+	if len(accepted) != len(want) {
+		t.Fatalf("want: %v, out: %d programs", want, len(accepted))
+	}
+	for i, c := range accepted {
+		if c.Title != want[i] {
+			t.Fatalf("want: %s, out: %s", want[i], c.Title)
+		}
+	}
+	if len(dropped) != 1 || dropped[0].Title != "low" {
+		t.Fatalf("want: [low], out: %v", dropped)
+	}
+}
+
+func Test_ParseRecpt1Cmd(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	start := time.Date(2018, 1, 15, 7, 30, 0, 0, jst)
+	p, err := ParseRecpt1Cmd("recpt1 --b25 --sid hd --strip 26 300 20180115T0730-ピタゴラスイッチ.ts\n", start)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if p.Provider != ETV || p.Title != "ピタゴラスイッチ" || p.Duration() != 5*time.Minute {
+		t.Fatalf("want: 26 300s ピタゴラスイッチ, out: %s %s %s", p.Provider, p.Duration(), p.Title)
+	}
+	if _, err := ParseRecpt1Cmd("recpt1 --b25 26 300", start); err == nil {
+		t.Fatalf("want error, out: nil")
+	}
+}
@@ -0,0 +1,49 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package epg
+
+import "strings"
+
+// ReplaceCharMap is the list of characters to replace to make shell safe string.
+var ReplaceCharMap = map[string]string{
+	"/": "／",
+	" ": "_",
+	"<": "＜",
+	">": "＞",
+	"?": "？",
+	"(": "（",
+	")": "）",
+	"#": "＃",
+	"*": "＊",
+	"$": "＄",
+	"&": "＆",
+	"^": "＾",
+	"!": "！",
+	"@": "＠",
+	"%": "％",
+	"+": "＋",
+	"[": "【",
+	"]": "】",
+}
+
+// SanitizeTitle trims t and replaces the characters in ReplaceCharMap so that
+// the title can be used as a part of filename in shell command.
+func SanitizeTitle(t string) string {
+	t = strings.TrimSpace(t)
+	for k, v := range ReplaceCharMap {
+		t = strings.Replace(t, k, v, -1)
+	}
+	return t
+}
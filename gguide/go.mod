@@ -3,7 +3,14 @@ module github.com/ymotongpoo/toolbox/gguide
 require (
 	github.com/PuerkitoBio/goquery v1.4.1
 	github.com/andybalholm/cascadia v1.0.0 // indirect
+	github.com/ymotongpoo/toolbox/booking v0.0.0
+	github.com/ymotongpoo/toolbox/epg v0.0.0
 	golang.org/x/net v0.0.0-20181005035420-146acd28ed58 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 go 1.13
+
+replace github.com/ymotongpoo/toolbox/booking => ../booking
+
+replace github.com/ymotongpoo/toolbox/epg => ../epg
@@ -15,6 +15,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
@@ -25,18 +26,14 @@ import (
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
 )
 
 const (
 	// BaseURL is the base URL of the G-guide web page.
 	BaseURL = "https://www.tvkingdom.jp"
 
-	// FilePrefixFormat is the standard prefix format of the file.
-	FilePrefixFormat = "20060102T1504"
-
-	// AtCmdFormat is the format to express the datetime in `at` command.
-	AtCmdFormat = "0601021504.05"
-
 	// NumWorkers is the number of the workers to fetch the detailed web page.
 	NumWorkers = 5
 )
@@ -48,241 +45,24 @@ var (
 	// JST is the default *time.Location variable to make time.Date.
 	JST *time.Location
 
-	// TitleFilter is the filter to pick only relevant programs based on program title.
-	TitleIncludeFilter []*regexp.Regexp
-	TitleExcludeFilter []*regexp.Regexp
-)
-
-// ReplaceCharMap is the list of characters to replace to make shell safe string.
-var ReplaceCharMap = map[string]string{
-	"/": "／",
-	" ": "_",
-	"<": "＜",
-	">": "＞",
-	"?": "？",
-	"(": "（",
-	")": "）",
-	"#": "＃",
-	"*": "＊",
-	"$": "＄",
-	"&": "＆",
-	"^": "＾",
-	"!": "！",
-	"@": "＠",
-	"%": "％",
-	"+": "＋",
-	"[": "【",
-	"]": "】",
-}
-
-// Provider is the enum type of the TV provider.
-type Provider string
+	// TitleRules is the set of rules to pick only relevant programs based on program title.
+	TitleRules *Rules
 
-const (
-	MX     Provider = "16"
-	CX              = "21"
-	TBS             = "22"
-	TX              = "23"
-	EX              = "24"
-	NTV             = "25"
-	ETV             = "26"
-	NHK             = "27"
-	UNIV            = "28"
-	BSEX            = "BS01_0"
-	BSTBS           = "BS01_1"
-	BSNTV           = "BS13_0"
-	BSCX            = "BS13_1"
-	BSTX            = "BS01_2"
-	NHKBS1          = "BS15_0"
-	NHKBS2          = "BS03_1"
-	BS11            = "BS09_0"
-	BS12            = "BS09_2"
+	rulesPath = flag.String("rules", DefaultRulesFile, "path to the title rules file")
+	storePath = flag.String("store", booking.DefaultStoreFile, "path to the booking store file")
+	grTuners  = flag.Int("gr-tuners", epg.DefaultTuners[epg.Terrestrial], "number of terrestrial tuners")
+	bsTuners  = flag.Int("bs-tuners", epg.DefaultTuners[epg.BS], "number of BS tuners")
+	book      = flag.Bool("book", false, "submit jobs to the scheduler directly instead of writing a shell script. Only the programs booked with it are recorded in the store.")
+	scheduler = flag.String("scheduler", booking.DefaultScheduler, "scheduler to book programs. 'at', 'systemd', 'systemd-user' or 'recorder' is available.")
+	dryRun    = flag.Bool("dry-run", false, "print the programs to book without booking them")
 )
 
-// ProviderMap is the map between the name strings and the enum values.
-var ProviderMap = map[string]Provider{
-	"ＮＨＫ総合１・東京(Ch.1)":   NHK,
-	"ＮＨＫＥテレ１・東京(Ch.2)":  ETV,
-	"日テレ(Ch.4)":         NTV,
-	"テレビ朝日(Ch.5)":       EX,
-	"ＴＢＳ(Ch.6)":         TBS,
-	"テレビ東京(Ch.7)":       TX,
-	"フジテレビ(Ch.8)":       CX,
-	"ＴＯＫＹＯ　ＭＸ１(Ch.9)":   MX,
-	"放送大学１(Ch.12)":      UNIV,
-	"ＮＨＫ ＢＳ１(Ch.1)":     NHKBS1,
-	"ＮＨＫ ＢＳプレミアム(Ch.3)": NHKBS2,
-	"ＢＳ日テレ(Ch.4)":       BSNTV,
-	"ＢＳ朝日(Ch.5)":        BSEX,
-	"ＢＳ-ＴＢＳ(Ch.6)":      BSTBS,
-	"ＢＳテレ東(Ch.7)":       BSTX,
-	"ＢＳフジ(Ch.8)":        BSCX,
-	"BS11イレブン(Ch.11)":   BS11,
-	"BS12 トゥエルビ(Ch.12)": BS12,
-}
-
-var IncludePattern = []string{
-	// Seasonal
-	`.*岸辺露伴.*`,
-	`.*タイガー.*`,
-	`.*俺の家の話.*`,
-	`.*はね駒.*`,
-	`.*スカーレット.*`,
-	`.*おしん.*`,
-	`.*いだてん.*`,
-	`.*東京箱根間往復大学駅伝競走.*`,
-	// Weekdays
-	`.*デザインあ.*`,
-	`.*ピタゴラスイッチ.*`,
-	`.*Eテレ0655.*`,
-	`.*Eテレ2355.*`,
-	`.*地球ドラマチック.*`,
-	`.*BS世界のドキュメンタリー.*`,
-	`.*クローズアップ現代.*`,
-	`.*日経プラス10.*`,
-	`.*ねほりんぱほりん.*`,
-	`.*ジョジョの奇妙な冒険.*`,
-	`.*ＷＢＳ.*`,
-	// Weekly
-	`.*旅するスペイン語.*`,
-	`.*タモリ倶楽部.*`,
-	`.*ブラタモリ.*`,
-	`.*鉄腕.*`,
-	`.*ドキュメント72時間.*`,
-	`.*ルパン三世.*`,
-	`.*ゴッドタン.*`,
-	`.*家事ヤロウ.*`,
-	`.*プロフェッショナル　仕事の流儀.*`,
-	`.*日本の話芸.*`,
-	`.*所さんの目がテン.*`,
-	`.*NHKスペシャル.*`,
-	`.*世界ふしぎ発見.*`,
-	`.*探偵\!ナイトスクープ.*`,
-	`.*世界仰天ニュース.*`,
-	`.*水曜どうでしょう.*`,
-	`.*マツコの知らない世界.*`,
-	`.*日本の話芸.*`,
-	`.*世界史.*`,
-	`.*日本史.*`,
-	`.*地理.*`,
-	`.*ビジネス基礎.*`,
-	`.*家庭総合.*`,
-	`.*社会と情報.*`,
-	`.*簿記.*`,
-	`.*将棋.*`,
-	`.*サラメシ.*`,
-	`.*ザ・ノンフィクション.*`,
-	`.*ガイアの夜明け.*`,
-	`.*映像研には手を出すな.*`,
-	`.*麒麟がくる.*`,
-	// Irregular
-	`.*BS1スペシャル.*`,
-	`.*新日本風土記.*`,
-	`.*落語研究会.*`,
-	`.*ATP.*`,
-	`.*ウィンブルドン.*`,
-	`.*全仏オープン.*`,
-	`.*全豪オープンテニス.*`,
-	`.*Why！？プログラミング.*`,
-	`.*カガクノミカタ.*`,
-	`.*ウルトラ重機.*`,
-	`.*アメトーーク.*`,
-	`.*奇跡体験！アンビリバボー.*`,
-	`.*ダーウィンが来た.*`,
-	`.*映像の世紀.*`,
-	`.*未来少年.*`,
-	`.*大家さんと僕.*`,
-	`.*地球事変.*`,
-	`.*みんなで筋肉体操.*`,
-	// Old
-	`.*聖☆おにいさん.*`,
-	`.*バカボンのパパ.*`,
-	`.*ぼくらはマンガで強くなった.*`,
-	`.*ポプテピピック.*`,
-	`.*花子とアン.*`,
-	`.*わろてんか.*`,
-	`.*あさが来た.*`,
-	`.*まんぷく.*`,
-	`.*べっぴんさん.*`,
-	`.*カーネーション.*`,
-	`.*半分、青い。.*`,
-	`.*なつぞら.*`,
-	`.*3月のライオン.*`,
-	`.*マッサン.*`,
-	`.*超入門！落語THE　MOVIE.*`,
-	`.*MR\. BEAN.*`,
-	`.*西郷どん.*`,
-	`.*INGRESS.*`,
-	`.*獣になれない私たち.*`,
-	`.*昭和元禄落語心中.*`,
-	`.*幽☆遊☆白書.*`,
-	`.*ピアノの森.*`,
-	`.*バキ.*`,
-	`.*オイコノミア.*`,
-	`.*刑事コロンボ.*`,
-	`.*植物男子.*`,
-	`.*探検バクモン.*`,
-	`.*ミス・ジコチョー.*`,
-	`.*少年寅次郎.*`,
-}
-
-var ExcludePattern = []string{
-	`.*プレマップ.*`,
-	`.*いじめをノックアウト.*`,
-	`.*まんぷく(農家|漁師)メシ.*`,
-	`.*応援ソング.*`,
-	`.*ネーミングバラエティ.*`,
-	`.*古関裕而.*`,
-	`.*銀河銭湯.*`,
-}
-
-func programTitleFilter() ([]*regexp.Regexp, []*regexp.Regexp) {
-	ret := []*regexp.Regexp{}
-	for _, p := range IncludePattern {
-		ret = append(ret, regexp.MustCompile(p))
-	}
-	ret2 := []*regexp.Regexp{}
-	for _, p := range ExcludePattern {
-		ret2 = append(ret2, regexp.MustCompile(p))
-	}
-	return ret, ret2
-}
-
 func init() {
 	var err error
 	JST, err = time.LoadLocation("Asia/Tokyo")
 	if err != nil {
 		panic(err)
 	}
-	TitleIncludeFilter, TitleExcludeFilter = programTitleFilter()
-}
-
-// Program is the struct to hold TV program metadata
-type Program struct {
-	URL         string
-	Title       string
-	Start       *time.Time
-	End         *time.Time
-	Channel     string
-	Provider    Provider
-	Summary     string
-	Description string
-}
-
-func (p *Program) String() string {
-	return fmt.Sprintf("%s %s (%s - %s) %s", p.Provider, p.URL, p.Start, p.End, p.Title)
-}
-
-// Recpt1AtCmd generates single line command string to book recpt1 command
-// at the specified time based on the value in p.
-func (p *Program) Recpt1AtCmd() string {
-	prefix := p.Start.Format(FilePrefixFormat)
-	filename := fmt.Sprintf("%s-%s.ts", prefix, p.Title)
-	duration := strconv.Itoa(int(p.End.Sub(*p.Start) / time.Second))
-	startTime := p.Start.Format(AtCmdFormat)
-	recpt1Str := []string{"echo", "recpt1", "--b25", "--sid", "hd", "--strip",
-		string(p.Provider), duration, filename, "|", "at", "-t", startTime}
-	return strings.Join(recpt1Str, " ")
 }
 
 func extractStartEndTime(t string) (*time.Time, *time.Time, error) {
@@ -331,21 +111,13 @@ func extractStartEndTime(t string) (*time.Time, *time.Time, error) {
 	return &start, &end, nil
 }
 
-func escapeTitle(t string) string {
-	for k, v := range ReplaceCharMap {
-		t = strings.Replace(t, k, v, -1)
-	}
-	return t
-}
-
-func extractProgramData(d *goquery.Document) (*Program, error) {
+func extractProgramData(d *goquery.Document) (*epg.Program, error) {
 	titleSel := d.Find("h1.basicContTitle").First()
 	if titleSel == nil {
 		return nil, fmt.Errorf("Title not found: %v", d.Url.String())
 	}
 	title := titleSel.Text()
 	title = strings.TrimSpace(title)
-	title = escapeTitle(title)
 
 	timeSel := d.Find("dl.basicTxt > dd").First()
 	timeText := strings.Replace(timeSel.Text(), "この時間帯の番組表", "", -1)
@@ -364,19 +136,19 @@ func extractProgramData(d *goquery.Document) (*Program, error) {
 	descSel := summarySel.Next()
 	desc := descSel.Text()
 
-	return &Program{
+	return &epg.Program{
 		URL:         d.Url.String(),
 		Title:       title,
-		Start:       start,
-		End:         end,
+		Start:       *start,
+		End:         *end,
 		Channel:     chanText,
-		Provider:    ProviderMap[chanText],
+		Provider:    epg.ProviderMap[chanText],
 		Summary:     summary,
 		Description: desc,
 	}, nil
 }
 
-func fetchDetail(wg *sync.WaitGroup, urls <-chan string, ps chan<- *Program) {
+func fetchDetail(wg *sync.WaitGroup, urls <-chan string, ps chan<- *epg.Program) {
 	defer wg.Done()
 	for {
 		url, ok := <-urls
@@ -393,43 +165,22 @@ func fetchDetail(wg *sync.WaitGroup, urls <-chan string, ps chan<- *Program) {
 			log.Printf("Error: couldn't extract program deta: %v", err)
 			continue
 		}
+		if !filterProgram(p) {
+			continue
+		}
 		ps <- p
 		time.Sleep(1 * time.Second)
 	}
 }
 
-// WriteToShellScript dumps the programs data from ps to generate
-// actual shell script to book those programs.
-func WriteToShellScript(ps <-chan *Program) error {
-	now := time.Now().Format("20060102T1504")
-	file, err := os.OpenFile(now+".sh", os.O_RDWR|os.O_CREATE, 0755)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-	fmt.Fprintln(file, "#!/bin/bash")
-	for p := range ps {
-		if p == nil {
-			fmt.Println("nil pointer")
-			continue
-		}
-		fmt.Fprintln(file, p.Recpt1AtCmd())
-	}
-	return nil
+func filterProgramWithTitle(title string) bool {
+	return TitleRules.MatchTitle(title)
 }
 
-func filterProgramWithTitle(title string) bool {
-	for _, p := range TitleExcludeFilter {
-		if p.MatchString(title) {
-			return false
-		}
-	}
-	for _, p := range TitleIncludeFilter {
-		if p.MatchString(title) {
-			return true
-		}
-	}
-	return false
+// filterProgram checks the program with all the conditions in the rules,
+// including channels and weekdays which are only available on the detail page.
+func filterProgram(p *epg.Program) bool {
+	return TitleRules.Match(p)
 }
 
 func fetchAllProgramsStage(wg *sync.WaitGroup, ch chan<- string, d *goquery.Document) {
@@ -450,7 +201,7 @@ func fetchAllProgramsStage(wg *sync.WaitGroup, ch chan<- string, d *goquery.Docu
 	})
 }
 
-func fetchDetailStage(ch <-chan string, ps chan *Program) {
+func fetchDetailStage(ch <-chan string, ps chan *epg.Program) {
 	var wg sync.WaitGroup
 	for i := 0; i < NumWorkers; i++ {
 		wg.Add(1)
@@ -461,6 +212,24 @@ func fetchDetailStage(ch <-chan string, ps chan *Program) {
 }
 
 func main() {
+	flag.Parse()
+	rs, err := LoadRules(*rulesPath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	TitleRules = rs
+	sched, err := booking.NewScheduler(*scheduler)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	store, err := booking.Open(*storePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	if err := store.Purge(time.Now()); err != nil {
+		log.Fatalln(err)
+	}
+
 	charts := []string{
 		BaseURL + "/chart/23.action?span=168",
 		BaseURL + "/chart/bs1.action?span=168",
@@ -483,10 +252,35 @@ func main() {
 		close(urlCh)
 	}()
 
-	programCh := make(chan *Program)
+	programCh := make(chan *epg.Program)
 	go fetchDetailStage(urlCh, programCh)
 
-	if err := WriteToShellScript(programCh); err != nil {
+	booked, err := booking.BookedPrograms(sched, store)
+	if err != nil {
+		log.Printf("Warning: couldn't read booked jobs: %v", err)
+	}
+	ps := newPrograms(programCh, store, booked)
+	tuners := epg.Tuners{
+		epg.Terrestrial: *grTuners,
+		epg.BS:          *bsTuners,
+	}
+	ps = resolveConflicts(ps, booked, tuners)
+
+	var out Output
+	switch {
+	case *dryRun:
+		out = &DryRunOutput{w: os.Stdout, sched: sched}
+	case *book:
+		out = &SchedulerOutput{sched: sched}
+	default:
+		out, err = NewScriptOutput(sched)
+		if err != nil {
+			log.Fatalln(err)
+		}
+	}
+	// the programs in the shell script are not recorded since the script may
+	// not be run. They are found in the scheduler once it is run.
+	if err := BookPrograms(ps, out, store, *book && !*dryRun); err != nil {
 		log.Fatalln(err)
 	}
 }
@@ -0,0 +1,123 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// Output is the backend to book the programs.
+type Output interface {
+	// Book books the program p and returns the job ID if available.
+	Book(p *epg.Program) (string, error)
+	// Close finishes the output.
+	Close() error
+}
+
+// ScriptOutput writes the commands to book programs into a shell script.
+type ScriptOutput struct {
+	file  *os.File
+	sched booking.Scheduler
+}
+
+// NewScriptOutput creates the shell script named after the current time.
+// The commands in the script book programs with sched.
+func NewScriptOutput(sched booking.Scheduler) (*ScriptOutput, error) {
+	now := time.Now().Format("20060102T1504")
+	file, err := os.OpenFile(now+".sh", os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintln(file, "#!/bin/bash")
+	return &ScriptOutput{file: file, sched: sched}, nil
+}
+
+// Book appends the line to book p to the shell script.
+func (o *ScriptOutput) Book(p *epg.Program) (string, error) {
+	_, err := fmt.Fprintln(o.file, o.sched.Command(p))
+	return "", err
+}
+
+// Close closes the shell script.
+func (o *ScriptOutput) Close() error {
+	return o.file.Close()
+}
+
+// SchedulerOutput submits jobs to the scheduler directly.
+type SchedulerOutput struct {
+	sched booking.Scheduler
+}
+
+// Book submits the job to record p.
+func (o *SchedulerOutput) Book(p *epg.Program) (string, error) {
+	return o.sched.Schedule(p)
+}
+
+// Close does nothing.
+func (o *SchedulerOutput) Close() error {
+	return nil
+}
+
+// DryRunOutput only prints what would be scheduled.
+type DryRunOutput struct {
+	w     io.Writer
+	sched booking.Scheduler
+}
+
+// Book prints the command to book p.
+func (o *DryRunOutput) Book(p *epg.Program) (string, error) {
+	_, err := fmt.Fprintln(o.w, o.sched.Command(p))
+	return "", err
+}
+
+// Close does nothing.
+func (o *DryRunOutput) Close() error {
+	return nil
+}
+
+// BookPrograms books all the programs in ps with out. When record is true,
+// booked programs are recorded in store with their job IDs and printed. It
+// must be true only when out actually schedules the jobs.
+func BookPrograms(ps []*epg.Program, out Output, store *booking.Store, record bool) error {
+	for _, p := range ps {
+		id, err := out.Book(p)
+		if err != nil {
+			log.Printf("Error: couldn't book %v: %v", p, err)
+			continue
+		}
+		// the other outputs write the programs by themselves.
+		if !record {
+			continue
+		}
+		e := booking.NewEntry(p)
+		e.JobID = id
+		if err := store.Add(e); err != nil {
+			return err
+		}
+		if id != "" {
+			fmt.Printf("Job ID: %v -> %v\n", id, p)
+		} else {
+			fmt.Println(p)
+		}
+	}
+	return out.Close()
+}
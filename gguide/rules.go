@@ -0,0 +1,198 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultRulesFile is the filename of the YAML file where title rules are recorded.
+const DefaultRulesFile = "rules.yaml"
+
+// Rules is the set of include and exclude rules to pick programs.
+type Rules struct {
+	Include []*Rule `yaml:"include"`
+	Exclude []*Rule `yaml:"exclude"`
+}
+
+// Rule matches a program by its title, and optionally by channel and weekday.
+type Rule struct {
+	Pattern  *regexp.Regexp
+	Channels []string
+	Weekdays []time.Weekday
+	Priority int
+	Line     int
+}
+
+type ruleSpec struct {
+	Pattern  string   `yaml:"pattern"`
+	Channels []string `yaml:"channels"`
+	Weekdays []string `yaml:"weekdays"`
+	Priority int      `yaml:"priority"`
+}
+
+// UnmarshalYAML accepts either a bare pattern string or a mapping with
+// pattern, channels and weekdays.
+func (r *Rule) UnmarshalYAML(n *yaml.Node) error {
+	var spec ruleSpec
+	switch n.Kind {
+	case yaml.ScalarNode:
+		spec.Pattern = n.Value
+	case yaml.MappingNode:
+		if err := n.Decode(&spec); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("line %d: rule must be a string or a mapping", n.Line)
+	}
+	if spec.Pattern == "" {
+		return fmt.Errorf("line %d: pattern is empty", n.Line)
+	}
+	re, err := regexp.Compile(spec.Pattern)
+	if err != nil {
+		return fmt.Errorf("line %d: invalid pattern %q: %v", n.Line, spec.Pattern, err)
+	}
+	weekdays := []time.Weekday{}
+	for _, w := range spec.Weekdays {
+		d, err := parseWeekday(w)
+		if err != nil {
+			return fmt.Errorf("line %d: %v", n.Line, err)
+		}
+		weekdays = append(weekdays, d)
+	}
+	r.Pattern = re
+	r.Channels = spec.Channels
+	r.Weekdays = weekdays
+	r.Priority = spec.Priority
+	r.Line = n.Line
+	return nil
+}
+
+func parseWeekday(s string) (time.Weekday, error) {
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := d.String()
+		if strings.EqualFold(s, name) || strings.EqualFold(s, name[:3]) {
+			return d, nil
+		}
+	}
+	return time.Sunday, fmt.Errorf("unknown weekday: %q", s)
+}
+
+// LoadRules reads the rules file in path and validates all the rules in it.
+func LoadRules(path string) (*Rules, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	rs, err := ParseRules(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return rs, nil
+}
+
+// ParseRules parses YAML data b into Rules.
+func ParseRules(b []byte) (*Rules, error) {
+	rs := &Rules{}
+	if err := yaml.Unmarshal(b, rs); err != nil {
+		return nil, err
+	}
+	return rs, nil
+}
+
+// MatchTitle reports whether the title is a candidate for recording.
+// Channel and weekday constraints are ignored because they are not available
+// on the program list page.
+func (rs *Rules) MatchTitle(title string) bool {
+	for _, r := range rs.Exclude {
+		if r.Pattern.MatchString(title) && len(r.Channels) == 0 && len(r.Weekdays) == 0 {
+			return false
+		}
+	}
+	for _, r := range rs.Include {
+		if r.Pattern.MatchString(title) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match reports whether the program p should be recorded.
+func (rs *Rules) Match(p *epg.Program) bool {
+	for _, r := range rs.Exclude {
+		if r.Match(p) {
+			return false
+		}
+	}
+	for _, r := range rs.Include {
+		if r.Match(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// Priority returns the highest priority of the include rules matching p.
+// It is used to decide which program to drop when recordings conflict.
+func (rs *Rules) Priority(p *epg.Program) int {
+	priority := 0
+	found := false
+	for _, r := range rs.Include {
+		if r.Match(p) && (!found || r.Priority > priority) {
+			priority = r.Priority
+			found = true
+		}
+	}
+	return priority
+}
+
+// Match reports whether the program p satisfies all the conditions in r.
+func (r *Rule) Match(p *epg.Program) bool {
+	if !r.Pattern.MatchString(p.Title) {
+		return false
+	}
+	if len(r.Channels) > 0 {
+		found := false
+		for _, c := range r.Channels {
+			if c == string(p.Provider) || c == p.Channel {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(r.Weekdays) > 0 {
+		found := false
+		for _, d := range r.Weekdays {
+			if d == p.Start.Weekday() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,98 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+const testRules = `include:
+  - '.*ピタゴラスイッチ.*'
+  - pattern: '.*ニュース.*'
+    channels: ['27']
+    weekdays: [Sat, sunday]
+exclude:
+  - '.*プレマップ.*'
+`
+
+func Test_ParseRules(t *testing.T) {
+	rs, err := ParseRules([]byte(testRules))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(rs.Include) != 2 || len(rs.Exclude) != 1 {
+		t.Fatalf("want: 2 include & 1 exclude, out: %d & %d", len(rs.Include), len(rs.Exclude))
+	}
+	r := rs.Include[1]
+	if r.Line != 3 {
+		t.Fatalf("want: line 3, out: %d", r.Line)
+	}
+	if len(r.Weekdays) != 2 || r.Weekdays[0] != time.Saturday || r.Weekdays[1] != time.Sunday {
+		t.Fatalf("want: [Saturday Sunday], out: %v", r.Weekdays)
+	}
+
+	sat := time.Date(2020, 12, 26, 7, 0, 0, 0, time.UTC)
+	mon := time.Date(2020, 12, 28, 7, 0, 0, 0, time.UTC)
+	in := []*epg.Program{
+		{Title: "ピタゴラスイッチ", Provider: epg.ETV, Start: mon},
+		{Title: "ＮＨＫニュース", Provider: epg.NHK, Start: sat},
+		{Title: "ＮＨＫニュース", Provider: epg.NHK, Start: mon},
+		{Title: "ＮＨＫニュース", Provider: epg.ETV, Start: sat},
+		{Title: "ピタゴラスイッチ　プレマップ", Provider: epg.ETV, Start: mon},
+	}
+	want := []bool{true, true, false, false, false}
+	for i, p := range in {
+		if out := rs.Match(p); out != want[i] {
+			t.Fatalf("%s: want: %v, out: %v", p.Title, want[i], out)
+		}
+	}
+}
+
+func Test_ParseRulesError(t *testing.T) {
+	in := []string{
+		"include:\n  - '.*ok.*'\n  - '.*(broken.*'\n",
+		"include:\n  - pattern: '.*ok.*'\n    weekdays: [Funday]\n",
+	}
+	want := []string{
+		"line 3:",
+		"line 2:",
+	}
+	for i, s := range in {
+		_, err := ParseRules([]byte(s))
+		if err == nil {
+			t.Fatalf("want error, out: nil")
+		}
+		if !strings.Contains(err.Error(), want[i]) {
+			t.Fatalf("want: %s, out: %s", want[i], err)
+		}
+	}
+}
+
+func Test_LoadDefaultRules(t *testing.T) {
+	rs, err := LoadRules(DefaultRulesFile)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !rs.MatchTitle("探偵!ナイトスクープ") {
+		t.Fatalf("want: match, out: no match")
+	}
+	if rs.MatchTitle("まんぷく農家メシ") {
+		t.Fatalf("want: no match, out: match")
+	}
+}
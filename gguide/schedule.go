@@ -0,0 +1,78 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// newPrograms drains ps and returns the programs not recorded in store nor
+// in booked yet.
+func newPrograms(ps <-chan *epg.Program, store *booking.Store, booked []*epg.Program) []*epg.Program {
+	news := []*epg.Program{}
+	seen := map[string]bool{}
+	for p := range ps {
+		if p == nil {
+			log.Printf("Error: nil program is received")
+			continue
+		}
+		key := booking.NewEntry(p).Key()
+		if store.IsBooked(key) || seen[key] || contains(booked, p) {
+			continue
+		}
+		seen[key] = true
+		news = append(news, p)
+	}
+	return news
+}
+
+// contains returns true if p is in ps. Programs are compared by the channel
+// and the start time since the jobs in the scheduler have no URL.
+func contains(ps []*epg.Program, p *epg.Program) bool {
+	for _, bp := range ps {
+		if bp.Provider == p.Provider && bp.Start.Equal(p.Start) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveConflicts drops the programs in ps which can't be recorded with the
+// tuners because of already booked programs or the other programs in ps,
+// and returns the rest.
+func resolveConflicts(ps, booked []*epg.Program, tuners epg.Tuners) []*epg.Program {
+	cs := []*epg.Candidate{}
+	for _, p := range booked {
+		cs = append(cs, &epg.Candidate{Program: p, Booked: true})
+	}
+	for _, p := range ps {
+		cs = append(cs, &epg.Candidate{Program: p, Priority: TitleRules.Priority(p)})
+	}
+	accepted, dropped := epg.Schedule(cs, tuners)
+	for _, c := range dropped {
+		fmt.Printf("dropped (%s tuners are busy): %s\n", c.Provider.Band(), c.Program)
+	}
+	ret := []*epg.Program{}
+	for _, c := range accepted {
+		if !c.Booked {
+			ret = append(ret, c.Program)
+		}
+	}
+	return ret
+}
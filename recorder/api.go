@@ -0,0 +1,84 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/ymotongpoo/toolbox/booking"
+)
+
+// Handler returns the HTTP API of r.
+//
+//	GET    /bookings       list all the jobs with their status
+//	POST   /bookings       book the recording of booking.Entry in the body
+//	DELETE /bookings/<id>  cancel the job
+func (r *Recorder) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/bookings", r.handleBookings)
+	mux.HandleFunc("/bookings/", r.handleBooking)
+	return mux
+}
+
+func (r *Recorder) handleBookings(w http.ResponseWriter, req *http.Request) {
+	switch req.Method {
+	case http.MethodGet:
+		writeJSON(w, http.StatusOK, r.Jobs())
+	case http.MethodPost:
+		e := &booking.Entry{}
+		if err := json.NewDecoder(req.Body).Decode(e); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		id, err := r.Add(e)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeJSON(w, http.StatusCreated, map[string]string{"id": id})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (r *Recorder) handleBooking(w http.ResponseWriter, req *http.Request) {
+	id := strings.TrimPrefix(req.URL.Path, "/bookings/")
+	switch req.Method {
+	case http.MethodGet:
+		for _, j := range r.Jobs() {
+			if j.ID == id {
+				writeJSON(w, http.StatusOK, j)
+				return
+			}
+		}
+		http.NotFound(w, req)
+	case http.MethodDelete:
+		if err := r.Cancel(id); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
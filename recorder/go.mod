@@ -0,0 +1,13 @@
+module github.com/ymotongpoo/toolbox/recorder
+
+go 1.13
+
+require (
+	github.com/ymotongpoo/toolbox/booking v0.0.0
+	github.com/ymotongpoo/toolbox/epg v0.0.0
+)
+
+replace (
+	github.com/ymotongpoo/toolbox/booking => ../booking
+	github.com/ymotongpoo/toolbox/epg => ../epg
+)
@@ -0,0 +1,85 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+// recorder is the daemon to run recpt1 for the booked programs by itself
+// instead of delegating to at.
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/booking"
+)
+
+const (
+	// DefaultStoreFile is the filename of JSON file where the bookings are kept.
+	DefaultStoreFile = "recorder.json"
+
+	// DefaultInterval is the interval to check the bookings to start.
+	DefaultInterval = 1 * time.Second
+)
+
+var (
+	addr      = flag.String("addr", booking.DefaultRecorderAddr, "address to serve the HTTP API")
+	storePath = flag.String("store", DefaultStoreFile, "path to the booking list file")
+	recpt1    = flag.String("recpt1", "recpt1", "path to recpt1 command")
+	dir       = flag.String("dir", ".", "directory to write recorded files")
+	preRoll   = flag.Duration("preroll", 10*time.Second, "margin to start recording before the program")
+	postRoll  = flag.Duration("postroll", 10*time.Second, "margin to keep recording after the program")
+	retries   = flag.Int("retries", 3, "number of retries when recpt1 exits early")
+)
+
+func main() {
+	flag.Parse()
+	store, err := booking.Open(*storePath)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	r := NewRecorder(store)
+	r.Recpt1 = *recpt1
+	r.Dir = *dir
+	r.PreRoll = *preRoll
+	r.PostRoll = *postRoll
+	r.Retries = *retries
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(DefaultInterval, stop)
+		close(done)
+	}()
+	go func() {
+		log.Printf("[recorder] serving on %s", *addr)
+		if err := http.ListenAndServe(*addr, r.Handler()); err != nil {
+			log.Fatalln(err)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+	log.Println("[recorder] waiting for running recordings to finish")
+	close(stop)
+	select {
+	case <-done:
+	case <-sig:
+		log.Println("[recorder] exit without waiting")
+	}
+}
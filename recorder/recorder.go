@@ -0,0 +1,338 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// State is the state of the recording job.
+type State string
+
+const (
+	Scheduled State = "scheduled"
+	Recording State = "recording"
+	Done      State = "done"
+	Failed    State = "failed"
+	Canceled  State = "canceled"
+)
+
+const (
+	// endSlack is the tolerance to regard recpt1 as finished normally.
+	endSlack = 2 * time.Second
+
+	// jobRetention is how long the finished jobs are kept to be listed.
+	jobRetention = 24 * time.Hour
+)
+
+// Job is the status of a booked recording.
+type Job struct {
+	ID        string         `json:"id"`
+	Entry     *booking.Entry `json:"entry"`
+	State     State          `json:"state"`
+	Attempts  int            `json:"attempts"`
+	Files     []string       `json:"files,omitempty"`
+	LastError string         `json:"last_error,omitempty"`
+
+	cmd      *exec.Cmd
+	canceled bool
+}
+
+// jobID returns the ID of the job to record e. The entries booked before
+// IDs were assigned on Add fall back to the ID from start time and channel.
+func jobID(e *booking.Entry) string {
+	if e.JobID != "" {
+		return e.JobID
+	}
+	return baseJobID(e)
+}
+
+// baseJobID returns the ID made from the start time and the channel of e.
+func baseJobID(e *booking.Entry) string {
+	return e.Start.In(time.Local).Format(epg.FilePrefixFormat) + "-" + e.Channel
+}
+
+// Recorder runs recpt1 for the bookings in the store at their start time.
+type Recorder struct {
+	// Recpt1 is the path to recpt1 command.
+	Recpt1 string
+	// Dir is the directory where recorded files are written.
+	Dir string
+	// PreRoll is the margin to start recording before the program starts.
+	PreRoll time.Duration
+	// PostRoll is the margin to keep recording after the program ends.
+	PostRoll time.Duration
+	// Retries is the number of the retries when recpt1 exits early.
+	Retries int
+
+	store *booking.Store
+	mu    sync.Mutex
+	jobs  map[string]*Job
+	wg    sync.WaitGroup
+}
+
+// NewRecorder creates Recorder with the booking list in store.
+func NewRecorder(store *booking.Store) *Recorder {
+	return &Recorder{
+		Recpt1: "recpt1",
+		Dir:    ".",
+		store:  store,
+		jobs:   map[string]*Job{},
+	}
+}
+
+// Add books the recording of e.
+func (r *Recorder) Add(e *booking.Entry) (string, error) {
+	if !e.End.After(e.Start) {
+		return "", fmt.Errorf("end time must be after start time: %v ~ %v", e.Start, e.End)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	e.JobID = r.newJobID(e)
+	if err := r.store.Add(e); err != nil {
+		return "", err
+	}
+	return e.JobID, nil
+}
+
+// newJobID returns the ID of e which is not used by any other booking or job.
+// Booking the same program again keeps its ID. It must be called with r.mu held.
+func (r *Recorder) newJobID(e *booking.Entry) string {
+	if b := r.store.Get(e.Key()); b != nil {
+		return jobID(b)
+	}
+	used := map[string]bool{}
+	for id := range r.jobs {
+		used[id] = true
+	}
+	for _, b := range r.store.Entries() {
+		used[jobID(b)] = true
+	}
+	base := baseJobID(e)
+	id := base
+	for n := 2; used[id]; n++ {
+		id = fmt.Sprintf("%s-%d", base, n)
+	}
+	return id
+}
+
+// Cancel deletes the booking with the id, and stops recpt1 if it is running.
+func (r *Recorder) Cancel(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	found := false
+	for _, e := range r.store.Entries() {
+		if jobID(e) != id {
+			continue
+		}
+		found = true
+		if err := r.store.Remove(e.Key()); err != nil {
+			return err
+		}
+	}
+	if j, ok := r.jobs[id]; ok && !finished(j) {
+		found = true
+		j.canceled = true
+		j.State = Canceled
+		if j.cmd != nil && j.cmd.Process != nil {
+			j.cmd.Process.Kill()
+		}
+	}
+	if !found {
+		return fmt.Errorf("job not found: %v", id)
+	}
+	return nil
+}
+
+// Jobs returns the status of all the jobs, both booked and already run,
+// sorted by start time.
+func (r *Recorder) Jobs() []*Job {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := []*Job{}
+	seen := map[string]bool{}
+	for _, j := range r.jobs {
+		seen[j.ID] = true
+		c := *j
+		jobs = append(jobs, &c)
+	}
+	for _, e := range r.store.Entries() {
+		id := jobID(e)
+		if seen[id] {
+			continue
+		}
+		jobs = append(jobs, &Job{
+			ID:    id,
+			Entry: e,
+			State: Scheduled,
+		})
+	}
+	sort.Slice(jobs, func(i, j int) bool {
+		return jobs[i].Entry.Start.Before(jobs[j].Entry.Start)
+	})
+	return jobs
+}
+
+// Run checks the bookings every interval and starts recordings on time.
+// It returns when stop is closed, after all the running recordings finish.
+func (r *Recorder) Run(interval time.Duration, stop <-chan struct{}) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	r.dispatch(time.Now())
+	for {
+		select {
+		case now := <-t.C:
+			r.dispatch(now)
+		case <-stop:
+			r.wg.Wait()
+			return
+		}
+	}
+}
+
+// dispatch starts the recordings which should be running at now, and
+// forgets the jobs finished more than jobRetention ago.
+func (r *Recorder) dispatch(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, j := range r.jobs {
+		if finished(j) && now.After(j.Entry.End.Add(r.PostRoll+jobRetention)) {
+			delete(r.jobs, id)
+		}
+	}
+	for _, e := range r.store.Entries() {
+		id := jobID(e)
+		if j, ok := r.jobs[id]; ok && !finished(j) {
+			continue
+		}
+		start := e.Start.Add(-r.PreRoll)
+		end := e.End.Add(r.PostRoll)
+		if now.Before(start) {
+			continue
+		}
+		j := &Job{
+			ID:    id,
+			Entry: e,
+			State: Recording,
+		}
+		r.jobs[id] = j
+		if !now.Before(end.Add(-endSlack)) {
+			j.State = Failed
+			j.LastError = "missed the start time"
+			log.Printf("[recorder] %s: missed %v", id, e.Title)
+			r.finish(j)
+			continue
+		}
+		r.wg.Add(1)
+		go r.record(j, end)
+	}
+}
+
+// record runs recpt1 until end, and runs it again when it exits early.
+func (r *Recorder) record(j *Job, end time.Time) {
+	defer r.wg.Done()
+	p := j.Entry.Program()
+	for attempt := 1; attempt <= r.Retries+1; attempt++ {
+		remain := time.Until(end).Round(time.Second)
+		if remain < time.Second {
+			break
+		}
+		filename := r.newFilename(p, attempt)
+		cmd := exec.Command(r.Recpt1, p.Recpt1ArgsFor(remain, filename)...)
+		cmd.Dir = r.Dir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+
+		r.mu.Lock()
+		if j.canceled {
+			r.mu.Unlock()
+			return
+		}
+		j.cmd = cmd
+		j.Attempts = attempt
+		j.Files = append(j.Files, filename)
+		r.mu.Unlock()
+
+		log.Printf("[recorder] %s: start recording %v (%v, attempt %d)", j.ID, p.Title, remain, attempt)
+		err := cmd.Run()
+
+		r.mu.Lock()
+		j.cmd = nil
+		if j.canceled {
+			r.mu.Unlock()
+			log.Printf("[recorder] %s: canceled", j.ID)
+			return
+		}
+		if time.Now().After(end.Add(-endSlack)) {
+			j.State = Done
+			r.finish(j)
+			r.mu.Unlock()
+			log.Printf("[recorder] %s: done", j.ID)
+			return
+		}
+		if err != nil {
+			j.LastError = err.Error()
+		} else {
+			j.LastError = "recpt1 exited early"
+		}
+		r.mu.Unlock()
+		log.Printf("[recorder] %s: recpt1 exited early: %v", j.ID, j.LastError)
+	}
+	r.mu.Lock()
+	j.State = Failed
+	r.finish(j)
+	r.mu.Unlock()
+}
+
+// newFilename returns the filename to record p into at attempt. The retries
+// append "-N" to the name, and so do the attempts whose file already exists,
+// e.g. recorded before restart, so that the recorded files are never
+// overwritten.
+func (r *Recorder) newFilename(p *epg.Program, attempt int) string {
+	base := strings.TrimSuffix(p.Filename(), ".ts")
+	filename := p.Filename()
+	for n := attempt; ; n++ {
+		if n > 1 {
+			filename = fmt.Sprintf("%s-%d.ts", base, n)
+		}
+		if _, err := os.Stat(filepath.Join(r.Dir, filename)); err != nil {
+			return filename
+		}
+	}
+}
+
+// finished reports whether j is no longer scheduled nor recording.
+func finished(j *Job) bool {
+	return j.State == Done || j.State == Failed || j.State == Canceled
+}
+
+// finish removes the booking of j from the store so that it is not
+// recorded again after restart. It must be called with r.mu held.
+func (r *Recorder) finish(j *Job) {
+	if err := r.store.Remove(j.Entry.Key()); err != nil {
+		log.Printf("[recorder] %s: %v", j.ID, err)
+	}
+}
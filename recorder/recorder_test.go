@@ -0,0 +1,230 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/booking"
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// fakeRecpt1 exits immediately on the first run, and sleeps for the given
+// duration on the later runs, writing its arguments into the output file.
+const fakeRecpt1 = `#!/bin/sh
+for last; do :; done
+if [ ! -e first ]; then
+  touch first
+  exit 1
+fi
+eval "duration=\${$(($# - 1))}"
+echo "$@" > "$last"
+sleep "$duration"
+`
+
+func Test_Recorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	recpt1 := filepath.Join(dir, "recpt1")
+	if err := ioutil.WriteFile(recpt1, []byte(fakeRecpt1), 0755); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	store, err := booking.Open(filepath.Join(dir, DefaultStoreFile))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	r := NewRecorder(store)
+	r.Recpt1 = recpt1
+	r.Dir = dir
+	r.Retries = 1
+
+	s := httptest.NewServer(r.Handler())
+	defer s.Close()
+	sched := &booking.RecorderScheduler{URL: s.URL}
+
+	start := time.Now().Add(time.Second).Truncate(time.Second)
+	p := &epg.Program{
+		Title:    "ピタゴラスイッチ",
+		Provider: epg.ETV,
+		Start:    start,
+		End:      start.Add(3 * time.Second),
+	}
+	id, err := sched.Schedule(p)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	jobs, err := sched.List()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(jobs) != 1 || jobs[0].ID != id {
+		t.Fatalf("want: [%s], out: %v", id, jobs)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(100*time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(time.Until(p.End) + 500*time.Millisecond)
+	close(stop)
+	<-done
+
+	all := r.Jobs()
+	if len(all) != 1 {
+		t.Fatalf("want: 1 job, out: %d", len(all))
+	}
+	j := all[0]
+	if j.State != Done || j.Attempts != 2 {
+		t.Fatalf("want: done in 2 attempts, out: %s in %d attempts (%s)", j.State, j.Attempts, j.LastError)
+	}
+	retried := filepath.Join(dir, start.Format(epg.FilePrefixFormat)+"-ピタゴラスイッチ-2.ts")
+	if _, err := os.Stat(retried); err != nil {
+		t.Fatalf("want: %s, out: %s", retried, err)
+	}
+	if store.IsBooked(j.Entry.Key()) {
+		t.Fatalf("want: %s removed from the store, out: still booked", j.ID)
+	}
+}
+
+func Test_RecorderCancel(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := booking.Open(filepath.Join(dir, DefaultStoreFile))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	r := NewRecorder(store)
+
+	start := time.Now().Add(time.Hour).Truncate(time.Minute)
+	ids := []string{}
+	for _, url := range []string{"http://example.com/1", "http://example.com/2"} {
+		id, err := r.Add(&booking.Entry{
+			URL:     url,
+			Channel: string(epg.ETV),
+			Title:   "ピタゴラスイッチ",
+			Start:   start,
+			End:     start.Add(10 * time.Minute),
+		})
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		ids = append(ids, id)
+	}
+	if ids[0] == ids[1] {
+		t.Fatalf("want: unique IDs, out: %v", ids)
+	}
+	if err := r.Cancel(ids[0]); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	jobs := r.Jobs()
+	if len(jobs) != 1 || jobs[0].ID != ids[1] {
+		t.Fatalf("want: [%s], out: %v", ids[1], jobs)
+	}
+
+	if err := r.Cancel(ids[1]); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	// the finished jobs are forgotten after jobRetention.
+	j := &Job{ID: ids[0], Entry: &booking.Entry{Start: start, End: start.Add(10 * time.Minute)}, State: Done}
+	r.jobs[j.ID] = j
+	r.dispatch(j.Entry.End.Add(time.Minute))
+	if _, ok := r.jobs[j.ID]; !ok {
+		t.Fatalf("want: %s kept, out: removed", j.ID)
+	}
+	r.dispatch(j.Entry.End.Add(jobRetention + time.Minute))
+	if _, ok := r.jobs[j.ID]; ok {
+		t.Fatalf("want: %s removed, out: kept", j.ID)
+	}
+}
+
+func Test_RecorderRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recorder")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	recpt1 := filepath.Join(dir, "recpt1")
+	if err := ioutil.WriteFile(recpt1, []byte(fakeRecpt1), 0755); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	// recpt1 doesn't fail on the first run since it was run before restart.
+	if err := ioutil.WriteFile(filepath.Join(dir, "first"), nil, 0644); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	store, err := booking.Open(filepath.Join(dir, DefaultStoreFile))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	r := NewRecorder(store)
+	r.Recpt1 = recpt1
+	r.Dir = dir
+
+	start := time.Now().Add(-time.Minute).Truncate(time.Second)
+	p := &epg.Program{
+		Title:    "ピタゴラスイッチ",
+		Provider: epg.ETV,
+		Start:    start,
+		End:      time.Now().Add(4 * time.Second),
+	}
+	// the partial file recorded before restart.
+	partial := filepath.Join(dir, p.Filename())
+	if err := ioutil.WriteFile(partial, []byte("partial"), 0644); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := r.Add(booking.NewEntry(p)); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		r.Run(100*time.Millisecond, stop)
+		close(done)
+	}()
+	time.Sleep(time.Until(p.End) + 500*time.Millisecond)
+	close(stop)
+	<-done
+
+	b, err := ioutil.ReadFile(partial)
+	if err != nil || string(b) != "partial" {
+		t.Fatalf("want: partial, out: %s (%v)", b, err)
+	}
+	resumed := strings.TrimSuffix(p.Filename(), ".ts") + "-2.ts"
+	all := r.Jobs()
+	if len(all) != 1 {
+		t.Fatalf("want: 1 job, out: %d", len(all))
+	}
+	if j := all[0]; len(j.Files) != 1 || j.Files[0] != resumed {
+		t.Fatalf("want: [%s], out: %v (%s)", resumed, j.Files, j.LastError)
+	}
+	if _, err := os.Stat(filepath.Join(dir, resumed)); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+}
@@ -0,0 +1,78 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+)
+
+// Checksums are the checksums of the content in hex. Empty fields are
+// unknown.
+type Checksums struct {
+	MD5    string
+	SHA256 string
+}
+
+// fileChecksums returns the checksums of the file at path.
+func fileChecksums(path string) (Checksums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return Checksums{}, err
+	}
+	defer f.Close()
+	m, s := md5.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(m, s), f); err != nil {
+		return Checksums{}, err
+	}
+	return Checksums{
+		MD5:    hex.EncodeToString(m.Sum(nil)),
+		SHA256: hex.EncodeToString(s.Sum(nil)),
+	}, nil
+}
+
+// checksumError is returned when the content doesn't match the checksum.
+type checksumError struct {
+	path string
+	algo string
+	want string
+	got  string
+	// deleteErr is the failure to delete the broken object.
+	deleteErr error
+}
+
+func (e *checksumError) Error() string {
+	s := fmt.Sprintf("%s mismatch of %v: %v, want %v", e.algo, e.path, e.got, e.want)
+	if e.deleteErr != nil {
+		s += fmt.Sprintf(", and failed to delete it: %v", e.deleteErr)
+	}
+	return s
+}
+
+// match returns checksumError if got differs from c in the fields known in
+// both.
+func (c Checksums) match(path string, got Checksums) error {
+	if c.SHA256 != "" && got.SHA256 != "" && c.SHA256 != got.SHA256 {
+		return &checksumError{path: path, algo: "sha256", want: c.SHA256, got: got.SHA256}
+	}
+	if c.MD5 != "" && got.MD5 != "" && c.MD5 != got.MD5 {
+		return &checksumError{path: path, algo: "md5", want: c.MD5, got: got.MD5}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPipeline is the name of the pipeline built from the folder ID
+// constants, used when no config file is given.
+const DefaultPipeline = "default"
+
+// Config is the configuration of sync-tool loaded from YAML file.
+//
+//	storage:
+//	  type: drive
+//	profiles:
+//	  - name: x264-720p
+//	    ext: .mp4
+//	    args: ["-i", "{input}", "-c:v", "libx264", "-vf", "scale=-2:720", "{output}"]
+//	pipelines:
+//	  - name: anime
+//	    match: "アニメ|劇場版"
+//	    inbox: <folder ID>
+//	    done: <folder ID>
+//	    output: <folder ID>
+//	    profile: x265
+//	    rules:
+//	      - match: "劇場版"
+//	        profile: av1
+//	  - name: news
+//	    inbox: <folder ID>
+//	    done: <folder ID>
+//	    output: <folder ID>
+//	    profile: x264-720p
+//	retry:
+//	  encode: {max_attempts: 2, backoff: 10m, max_backoff: 1h}
+type Config struct {
+	// Storage is where the files are exchanged. Google Drive is used if
+	// omitted.
+	Storage StorageConfig `yaml:"storage"`
+	// Profiles are the encode profiles in addition to BuiltinProfiles. The
+	// profile with the same name as a builtin one overrides it.
+	Profiles  []*Profile  `yaml:"profiles"`
+	Pipelines []*Pipeline `yaml:"pipelines"`
+	// Retry is the retry policy of each stage. DefaultRetryPolicy is used
+	// for the stages not specified.
+	Retry map[string]RetryPolicy `yaml:"retry"`
+}
+
+// Pipeline is a set of the folders and the encode settings applied to the
+// files uploaded into the inbox folder.
+type Pipeline struct {
+	Name string `yaml:"name"`
+	// Match is the regular expression of the filenames which sender uploads
+	// into this pipeline. The pipeline without Match accepts any file.
+	Match string `yaml:"match"`
+	// Inbox is the folder where sender puts the original files. Folders are
+	// the IDs on Google Drive, the directories on local storage, and the key
+	// prefixes on S3.
+	Inbox string `yaml:"inbox"`
+	// Done is the folder where the original files are moved after
+	// encoding process.
+	Done string `yaml:"done"`
+	// Output is the folder where encoded files are sent to.
+	Output string `yaml:"output"`
+	// Profile is the name of the encode profile. DefaultProfile is used if
+	// empty.
+	Profile string `yaml:"profile"`
+	// Rules select the profile by the filename prior to Profile.
+	Rules []*Rule `yaml:"rules"`
+
+	match *regexp.Regexp
+}
+
+// Rule selects the encode profile of the files whose name matches Match.
+type Rule struct {
+	Match   string `yaml:"match"`
+	Profile string `yaml:"profile"`
+
+	match *regexp.Regexp
+}
+
+// DefaultConfig returns the config with the single pipeline of the folder
+// ID constants.
+func DefaultConfig() *Config {
+	return &Config{
+		Pipelines: []*Pipeline{
+			{
+				Name:   DefaultPipeline,
+				Inbox:  UploadTargetFolderID,
+				Done:   EncodeDoneFolderID,
+				Output: MP4TargetFolderID,
+			},
+		},
+	}
+}
+
+// LoadConfig reads the config from the YAML file at path.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := ParseConfig(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return c, nil
+}
+
+// ParseConfig parses the config in YAML and validates it.
+func ParseConfig(b []byte) (*Config, error) {
+	c := &Config{}
+	if err := yaml.Unmarshal(b, c); err != nil {
+		return nil, err
+	}
+	if len(c.Pipelines) == 0 {
+		return nil, fmt.Errorf("no pipeline is defined")
+	}
+	if err := c.Storage.validate(); err != nil {
+		return nil, err
+	}
+	profiles := map[string]bool{}
+	for i, p := range c.Profiles {
+		if p.Name == "" {
+			return nil, fmt.Errorf("profile #%d: name is empty", i+1)
+		}
+		if profiles[p.Name] {
+			return nil, fmt.Errorf("profile %v: duplicated name", p.Name)
+		}
+		profiles[p.Name] = true
+		if err := p.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	for stage, p := range c.Retry {
+		switch stage {
+		case StageDownload, StageEncode, StageUpload:
+		default:
+			return nil, fmt.Errorf("retry: unknown stage %v", stage)
+		}
+		if err := p.validate(); err != nil {
+			return nil, fmt.Errorf("retry %v: %v", stage, err)
+		}
+	}
+	names := map[string]bool{}
+	for i, p := range c.Pipelines {
+		if p.Name == "" {
+			return nil, fmt.Errorf("pipeline #%d: name is empty", i+1)
+		}
+		if names[p.Name] {
+			return nil, fmt.Errorf("pipeline %v: duplicated name", p.Name)
+		}
+		names[p.Name] = true
+		if p.Inbox == "" || p.Done == "" || p.Output == "" {
+			return nil, fmt.Errorf("pipeline %v: inbox, done and output are required", p.Name)
+		}
+		if p.Match != "" {
+			re, err := regexp.Compile(p.Match)
+			if err != nil {
+				return nil, fmt.Errorf("pipeline %v: invalid match %q: %v", p.Name, p.Match, err)
+			}
+			p.match = re
+		}
+		if c.Profile(p.Profile) == nil {
+			return nil, fmt.Errorf("pipeline %v: unknown profile %v", p.Name, p.Profile)
+		}
+		for _, r := range p.Rules {
+			re, err := regexp.Compile(r.Match)
+			if err != nil || r.Match == "" {
+				return nil, fmt.Errorf("pipeline %v: invalid rule match %q: %v", p.Name, r.Match, err)
+			}
+			r.match = re
+			if r.Profile == "" || c.Profile(r.Profile) == nil {
+				return nil, fmt.Errorf("pipeline %v: unknown profile %q in rule %q", p.Name, r.Profile, r.Match)
+			}
+		}
+	}
+	return c, nil
+}
+
+// Pipeline returns the pipeline with the name, or nil if not found.
+func (c *Config) Pipeline(name string) *Pipeline {
+	for _, p := range c.Pipelines {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// PipelineFor returns the first pipeline which accepts the file at path, or
+// nil if no pipeline accepts it.
+func (c *Config) PipelineFor(path string) *Pipeline {
+	name := filepath.Base(path)
+	for _, p := range c.Pipelines {
+		if p.match == nil || p.match.MatchString(name) {
+			return p
+		}
+	}
+	return nil
+}
+
+// RetryPolicy returns the retry policy of stage.
+func (c *Config) RetryPolicy(stage string) RetryPolicy {
+	if p, ok := c.Retry[stage]; ok {
+		return p
+	}
+	return DefaultRetryPolicy
+}
+
+// Profile returns the profile with the name, or nil if not found. The empty
+// name means DefaultProfile.
+func (c *Config) Profile(name string) *Profile {
+	if name == "" {
+		name = DefaultProfile
+	}
+	for _, p := range c.Profiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	for _, p := range BuiltinProfiles {
+		if p.Name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// ProfileFor returns the profile to encode the file at path in pipeline p.
+func (c *Config) ProfileFor(p *Pipeline, path string) (*Profile, error) {
+	name := p.Profile
+	base := filepath.Base(path)
+	for _, r := range p.Rules {
+		if r.match != nil && r.match.MatchString(base) {
+			name = r.Profile
+			break
+		}
+	}
+	prof := c.Profile(name)
+	if prof == nil {
+		return nil, fmt.Errorf("pipeline %v: unknown profile %v", p.Name, name)
+	}
+	return prof, nil
+}
@@ -0,0 +1,78 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func Test_ParseConfig(t *testing.T) {
+	b, err := ioutil.ReadFile("pipelines.yaml")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	c, err := ParseConfig(b)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	tests := []struct {
+		path     string
+		pipeline string
+		profile  string
+	}{
+		{"/rec/201805262300_アニメ_第1話.ts", "anime", "x265"},
+		{"/rec/201805262300_劇場版_アニメ.ts", "anime", "av1"},
+		{"201805270100_ラジオ.ts", "radio", "audio"},
+		{"201805270700_ニュース.ts", DefaultPipeline, "x264-720p"},
+	}
+	for _, tt := range tests {
+		p := c.PipelineFor(tt.path)
+		if p == nil || p.Name != tt.pipeline {
+			t.Fatalf("want: %s, out: %v", tt.pipeline, p)
+		}
+		prof, err := c.ProfileFor(p, tt.path)
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if prof.Name != tt.profile {
+			t.Fatalf("want: %s, out: %s", tt.profile, prof.Name)
+		}
+	}
+
+	if p := c.RetryPolicy(StageEncode); p.MaxAttempts != 2 || p.Backoff != 10*time.Minute {
+		t.Fatalf("want: 2 attempts with 10m backoff, out: %v", p)
+	}
+	if p := c.RetryPolicy(StageUpload); p != DefaultRetryPolicy {
+		t.Fatalf("want: %v, out: %v", DefaultRetryPolicy, p)
+	}
+
+	invalid := []string{
+		"pipelines: []",
+		"pipelines:\n  - name: a\n    inbox: x\n    done: y\n",
+		"pipelines:\n  - {name: a, inbox: x, done: y, output: z}\n  - {name: a, inbox: x, done: y, output: z}\n",
+		"pipelines:\n  - {name: a, match: \"(\", inbox: x, done: y, output: z}\n",
+		"pipelines:\n  - {name: a, inbox: x, done: y, output: z, profile: h266}\n",
+		"pipelines:\n  - {name: a, inbox: x, done: y, output: z, rules: [{match: b, profile: h266}]}\n",
+		"pipelines:\n  - {name: a, inbox: x, done: y, output: z}\nretry:\n  perge: {max_attempts: 1}\n",
+		"profiles:\n  - {name: p, ext: .mp4, args: [-i, \"{input}\", \"{outptu}\"]}\npipelines:\n  - {name: a, inbox: x, done: y, output: z}\n",
+	}
+	for _, s := range invalid {
+		if _, err := ParseConfig([]byte(s)); err == nil {
+			t.Fatalf("want: error, out: nil for %q", s)
+		}
+	}
+}
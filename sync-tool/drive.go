@@ -0,0 +1,316 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"google.golang.org/api/drive/v3"
+)
+
+// DriveUploadURL is the endpoint to start resumable upload sessions.
+const DriveUploadURL = "https://www.googleapis.com/upload/drive/v3/files"
+
+// errSessionExpired is returned when the upload session is not available
+// any more and the upload has to start over.
+var errSessionExpired = errors.New("upload session expired")
+
+// driveStorage is Storage on Google Drive. The checksums given by the
+// uploader are recorded in appProperties of the file.
+type driveStorage struct {
+	service   *drive.Service
+	client    *http.Client
+	uploadURL string
+	chunkSize int64
+}
+
+func newDriveStorage(client *http.Client, chunkSize int64) (*driveStorage, error) {
+	service, err := drive.New(client)
+	if err != nil {
+		return nil, err
+	}
+	return &driveStorage{
+		service:   service,
+		client:    client,
+		uploadURL: DriveUploadURL,
+		chunkSize: chunkSize,
+	}, nil
+}
+
+func driveObject(f *drive.File) *Object {
+	return &Object{
+		ID:   f.Id,
+		Name: f.Name,
+		Size: f.Size,
+		Checksums: Checksums{
+			MD5:    f.Md5Checksum,
+			SHA256: f.AppProperties["sha256"],
+		},
+		URL: fmt.Sprintf(GoogleDriveOpenURL, f.Id),
+	}
+}
+
+func (s *driveStorage) List(ctx context.Context, folder string) ([]*Object, error) {
+	// see parameter setting on https://developers.google.com/drive/v3/web/search-parameters#fn4
+	query := fmt.Sprintf("'%s' in parents", folder)
+	objs := []*Object{}
+	err := s.service.Files.List().Q(query).Fields("nextPageToken", "files(id,name,size,md5Checksum,appProperties)").Pages(ctx, func(fl *drive.FileList) error {
+		for _, f := range fl.Files {
+			objs = append(objs, driveObject(f))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return objs, nil
+}
+
+func (s *driveStorage) Stat(ctx context.Context, id string) (*Object, error) {
+	f, err := s.service.Files.Get(id).Fields("id", "name", "size", "md5Checksum", "appProperties").Context(ctx).Do()
+	if err != nil {
+		return nil, err
+	}
+	return driveObject(f), nil
+}
+
+// Open requests the content from off with Range header.
+func (s *driveStorage) Open(ctx context.Context, id string, off int64) (io.ReadCloser, error) {
+	c := s.service.Files.Get(id).Context(ctx)
+	if off > 0 {
+		c.Header().Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+	res, err := c.Download()
+	if err != nil {
+		return nil, err
+	}
+	if off > 0 && res.StatusCode != http.StatusPartialContent {
+		// the server ignored Range and sends the whole content.
+		if _, err := io.CopyN(ioutil.Discard, res.Body, off); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
+	return res.Body, nil
+}
+
+func (s *driveStorage) Upload(ctx context.Context, path, folder, session string, save func(string) error, sums Checksums) (*Object, error) {
+	name := filepath.Base(path)
+	dst := &drive.File{
+		Name:     name,
+		Parents:  []string{folder},
+		MimeType: mime.TypeByExtension(filepath.Ext(name)),
+		AppProperties: map[string]string{
+			"md5":    sums.MD5,
+			"sha256": sums.SHA256,
+		},
+	}
+	f, err := s.uploadResumable(ctx, path, dst, session, save)
+	if err != nil {
+		return nil, err
+	}
+	return driveObject(f), nil
+}
+
+func (s *driveStorage) Move(ctx context.Context, id, from, to string) error {
+	_, err := s.service.Files.Update(id, nil).AddParents(to).RemoveParents(from).Context(ctx).Do()
+	return err
+}
+
+func (s *driveStorage) Delete(ctx context.Context, id string) error {
+	return s.service.Files.Delete(id).Context(ctx).Do()
+}
+
+// uploadResumable sends the file at path as dst with a resumable upload
+// session. It continues the session if given, and calls save with the new
+// session URI when it starts one so that the upload can be resumed after
+// the process restarts.
+func (s *driveStorage) uploadResumable(ctx context.Context, path string, dst *drive.File, session string, save func(string) error) (*drive.File, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+
+	start := func() error {
+		session, err = s.startSession(ctx, dst, size)
+		if err != nil {
+			return err
+		}
+		if save != nil {
+			return save(session)
+		}
+		return nil
+	}
+	var off int64
+	if session == "" {
+		if err := start(); err != nil {
+			return nil, err
+		}
+	} else {
+		var res *drive.File
+		off, res, err = s.sendChunk(ctx, session, f, 0, 0, size)
+		if err == errSessionExpired {
+			off = 0
+			err = start()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if res != nil {
+			return res, nil
+		}
+	}
+
+	failures := 0
+	for {
+		n := s.chunkSize
+		if n > size-off {
+			n = size - off
+		}
+		// an empty file, or the one whose bytes are all received, is
+		// finished by the request without content, "bytes */<size>".
+		next, res, err := s.sendChunk(ctx, session, f, off, n, size)
+		if err == nil {
+			if res != nil {
+				return res, nil
+			}
+			if n == 0 {
+				return nil, fmt.Errorf("upload %v: session is not finished with all %d bytes", path, size)
+			}
+			off, failures = next, 0
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if failures++; failures > maxTransferRetries {
+			return nil, err
+		}
+		if err := backoff(ctx, failures); err != nil {
+			return nil, err
+		}
+		// ask the server how much it has received, and continue from there.
+		next, res, err = s.sendChunk(ctx, session, f, 0, 0, size)
+		switch {
+		case err == errSessionExpired:
+			if err := start(); err != nil {
+				return nil, err
+			}
+			off = 0
+		case err != nil:
+			return nil, err
+		case res != nil:
+			return res, nil
+		default:
+			off = next
+		}
+	}
+}
+
+// startSession starts a resumable upload session of dst with size bytes,
+// and returns the session URI.
+func (s *driveStorage) startSession(ctx context.Context, dst *drive.File, size int64) (string, error) {
+	b, err := json.Marshal(dst)
+	if err != nil {
+		return "", err
+	}
+	url := s.uploadURL + "?uploadType=resumable&fields=id,name,size,md5Checksum,appProperties"
+	req, err := http.NewRequest("POST", url, bytes.NewReader(b))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json; charset=UTF-8")
+	req.Header.Set("X-Upload-Content-Length", strconv.FormatInt(size, 10))
+	if dst.MimeType != "" {
+		req.Header.Set("X-Upload-Content-Type", dst.MimeType)
+	}
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return "", responseError("start upload session", res)
+	}
+	session := res.Header.Get("Location")
+	if session == "" {
+		return "", fmt.Errorf("start upload session: no session URI")
+	}
+	return session, nil
+}
+
+// sendChunk sends n bytes of f from off in the session, and returns the
+// offset to send next, or the uploaded file if completed. It only asks the
+// status of the session if n is 0.
+func (s *driveStorage) sendChunk(ctx context.Context, session string, f *os.File, off, n, size int64) (int64, *drive.File, error) {
+	var body io.Reader
+	crange := fmt.Sprintf("bytes */%d", size)
+	if n > 0 {
+		body = io.NewSectionReader(f, off, n)
+		crange = fmt.Sprintf("bytes %d-%d/%d", off, off+n-1, size)
+	}
+	req, err := http.NewRequest("PUT", session, body)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.ContentLength = n
+	req.Header.Set("Content-Range", crange)
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		df := &drive.File{}
+		if err := json.NewDecoder(res.Body).Decode(df); err != nil {
+			return 0, nil, err
+		}
+		return size, df, nil
+	case http.StatusPermanentRedirect:
+		// "Range: bytes=0-N" is the range the server has received.
+		r := res.Header.Get("Range")
+		if r == "" {
+			return 0, nil, nil
+		}
+		i := strings.LastIndex(r, "-")
+		last, err := strconv.ParseInt(r[i+1:], 10, 64)
+		if i < 0 || err != nil {
+			return 0, nil, fmt.Errorf("upload: invalid range %q", r)
+		}
+		return last + 1, nil, nil
+	case http.StatusNotFound, http.StatusGone:
+		return 0, nil, errSessionExpired
+	}
+	return 0, nil, responseError("upload", res)
+}
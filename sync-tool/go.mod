@@ -0,0 +1,9 @@
+module github.com/ymotongpoo/toolbox/sync-tool
+
+go 1.12
+
+require (
+	golang.org/x/oauth2 v0.0.0-20190523182746-aaccbc9213b0
+	google.golang.org/api v0.5.0
+	gopkg.in/yaml.v3 v3.0.1
+)
@@ -47,11 +47,11 @@ func getHTTPClient(ctx context.Context, config *oauth2.Config) (*http.Client, er
 }
 
 func touchFile(p string) error {
-	err := os.Open(p)
-	if err == os.ErrNotExist {
-		_, err = os.Create(p)
+	f, err := os.OpenFile(p, os.O_RDONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return err
 	}
-	return err
+	return f.Close()
 }
 
 func getToken(cache string, config *oauth2.Config) (*oauth2.Token, error) {
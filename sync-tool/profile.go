@@ -0,0 +1,143 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// DefaultProfile is the name of the encode profile used when neither the
+// pipeline nor its rules specify one.
+const DefaultProfile = "x264"
+
+// Profile is a named set of ffmpeg options. Args may contain the placeholders
+// below, which are replaced for each file:
+//
+//	{input}   path of the original file
+//	{output}  path of the encoded file
+//	{name}    filename of the original file without the extension
+type Profile struct {
+	Name string `yaml:"name"`
+	// Ext is the extension of the encoded file appended to the original path.
+	Ext  string   `yaml:"ext"`
+	Args []string `yaml:"args"`
+}
+
+// placeholderRegexp matches the placeholders in the profile arguments.
+var placeholderRegexp = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// placeholders is the set of the placeholders available in the arguments.
+var placeholders = map[string]bool{
+	"input":  true,
+	"output": true,
+	"name":   true,
+}
+
+// BuiltinProfiles are the profiles available without defining them in config.
+var BuiltinProfiles = []*Profile{
+	{
+		Name: "x264",
+		Ext:  ".mp4",
+		Args: []string{
+			"-i", "{input}",
+			"-c:v", "libx264", "-crf", "20", "-preset", "slow", "-vf", "scale=1920:1080",
+			"-c:a", "aac", "-ar", "48000", "-b:a", "192k",
+			"-movflags", "+faststart", "-f", "mp4", "{output}",
+		},
+	},
+	{
+		Name: "x265",
+		Ext:  ".mp4",
+		Args: []string{
+			"-i", "{input}",
+			"-c:v", "libx265", "-crf", "22", "-preset", "medium", "-tag:v", "hvc1",
+			"-c:a", "aac", "-ar", "48000", "-b:a", "192k",
+			"-movflags", "+faststart", "-f", "mp4", "{output}",
+		},
+	},
+	{
+		Name: "av1",
+		Ext:  ".mp4",
+		Args: []string{
+			"-i", "{input}",
+			"-c:v", "libsvtav1", "-crf", "32", "-preset", "8",
+			"-c:a", "aac", "-ar", "48000", "-b:a", "192k",
+			"-movflags", "+faststart", "-f", "mp4", "{output}",
+		},
+	},
+	{
+		Name: "audio",
+		Ext:  ".m4a",
+		Args: []string{
+			"-i", "{input}",
+			"-vn", "-c:a", "aac", "-b:a", "192k",
+			"-f", "mp4", "{output}",
+		},
+	},
+	{
+		Name: "copy",
+		Ext:  ".mp4",
+		Args: []string{
+			"-i", "{input}",
+			"-map", "0:v:0", "-map", "0:a:0", "-c", "copy",
+			"-movflags", "+faststart", "-f", "mp4", "{output}",
+		},
+	},
+}
+
+// Validate returns error if p has unknown placeholders, or lacks {input} or
+// {output}.
+func (p *Profile) Validate() error {
+	found := map[string]bool{}
+	for _, a := range p.Args {
+		for _, m := range placeholderRegexp.FindAllStringSubmatch(a, -1) {
+			if !placeholders[m[1]] {
+				return fmt.Errorf("profile %v: unknown placeholder %v in %q", p.Name, m[0], a)
+			}
+			found[m[1]] = true
+		}
+	}
+	if !found["input"] || !found["output"] {
+		return fmt.Errorf("profile %v: {input} and {output} are required", p.Name)
+	}
+	if !strings.HasPrefix(p.Ext, ".") {
+		return fmt.Errorf("profile %v: ext must start with '.': %q", p.Name, p.Ext)
+	}
+	return nil
+}
+
+// Output returns the path of the file encoded from input.
+func (p *Profile) Output(input string) string {
+	return input + p.Ext
+}
+
+// Command returns the ffmpeg arguments to encode input into output.
+func (p *Profile) Command(input, output string) []string {
+	values := map[string]string{
+		"input":  input,
+		"output": output,
+		"name":   strings.TrimSuffix(filepath.Base(input), filepath.Ext(input)),
+	}
+	args := make([]string, len(p.Args))
+	for i, a := range p.Args {
+		args[i] = placeholderRegexp.ReplaceAllStringFunc(a, func(s string) string {
+			return values[s[1:len(s)-1]]
+		})
+	}
+	return args
+}
@@ -0,0 +1,52 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"strings"
+	"testing"
+)
+
+func Test_Profile(t *testing.T) {
+	for _, p := range BuiltinProfiles {
+		if err := p.Validate(); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	p := &Profile{
+		Name: "thumb",
+		Ext:  ".jpg",
+		Args: []string{"-i", "{input}", "-metadata", "title={name}", "-frames:v", "1", "{output}"},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	out := p.Output("/rec/a.ts")
+	want := "-i /rec/a.ts -metadata title=a -frames:v 1 /rec/a.ts.jpg"
+	if got := strings.Join(p.Command("/rec/a.ts", out), " "); got != want {
+		t.Fatalf("want: %s, out: %s", want, got)
+	}
+
+	invalid := []*Profile{
+		{Name: "a", Ext: ".mp4", Args: []string{"-i", "{input}", "{out}"}},
+		{Name: "b", Ext: ".mp4", Args: []string{"-i", "{input}", "out.mp4"}},
+		{Name: "c", Ext: "mp4", Args: []string{"-i", "{input}", "{output}"}},
+	}
+	for _, p := range invalid {
+		if err := p.Validate(); err == nil {
+			t.Fatalf("want: error, out: nil for %s", p.Name)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//    Copyright 2017 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/ymotongpoo/toolbox/sync-tool"
+)
+
+// runDead lists the files given up after failing too many times with the
+// last errors.
+func runDead(m *synctool.Manager) {
+	files := m.DeadLetters()
+	if len(files) == 0 {
+		fmt.Println("no dead file")
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tPATH\tSTAGE\tATTEMPTS\tLAST ERROR")
+	for _, f := range files {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\n", f.ID, f.Path, f.Stage, f.Attempts, f.LastError)
+	}
+	w.Flush()
+}
+
+// runRevive clears the failures of the dead files given by ID, path or
+// filename in args so that the next run of receiver processes them again.
+// It must run while receiver is stopped because receiver overwrites the
+// state file.
+func runRevive(m *synctool.Manager, args []string) {
+	if len(args) == 0 {
+		log.Fatalln("revive: specify ID or path of dead file")
+	}
+	for _, a := range args {
+		f, err := m.Revive(a)
+		if err != nil {
+			log.Fatalf("revive: %v\n", err)
+		}
+		fmt.Printf("revived %s (%s)\n", f.Path, f.ID)
+	}
+}
@@ -15,10 +15,13 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/ymotongpoo/toolbox/sync-tool"
@@ -30,6 +33,14 @@ const (
 
 	// DefaultPergeInterval is the interval to perge processed files.
 	DefaultPergeInterval = 1 * time.Hour
+
+	// retryCheckInterval is the interval to dispatch the failed files whose
+	// backoff has passed.
+	retryCheckInterval = 10 * time.Second
+
+	// DefaultGracePeriod is the period to wait for the running tasks on
+	// shutdown before aborting them.
+	DefaultGracePeriod = 1 * time.Minute
 )
 
 var (
@@ -37,6 +48,13 @@ var (
 	pollInterval  *time.Duration
 	pergeInterval *time.Duration
 	secretsPath   *string
+	statePath     *string
+	configPath    *string
+	downloads     *int
+	encodes       *int
+	uploads       *int
+	grace         *time.Duration
+	chunkSize     *int64
 )
 
 func init() {
@@ -44,100 +62,159 @@ func init() {
 	pollInterval = fs.Duration("poll", DefaultPollInterval, "polling interval duration")
 	pergeInterval = fs.Duration("perge", DefaultPergeInterval, "perge interval duration")
 	secretsPath = fs.String("secrets", synctool.DefaultSecretsFile, "path to client_secret.json file")
+	statePath = fs.String("state", synctool.DefaultStateFile, "path to the file to persist the state of files")
+	configPath = fs.String("config", "", "path to the pipelines config file (default: built-in folder IDs)")
+	downloads = fs.Int("downloads", 2, "number of concurrent downloads")
+	encodes = fs.Int("encodes", 1, "number of concurrent encodes")
+	uploads = fs.Int("uploads", 3, "number of concurrent uploads")
+	chunkSize = fs.Int64("chunk-size", synctool.DefaultChunkSize, "size of each request of uploads in bytes, rounded up to the multiple of 256KiB")
+	grace = fs.Duration("grace", DefaultGracePeriod, "period to wait for running tasks on shutdown before aborting them")
 }
 
 func checkOptions() {
 	log.Printf("poll interval is set to %s\n", *pollInterval)
 	log.Printf("perge interval is set to %s\n", *pergeInterval)
+	log.Printf("workers: %d downloads, %d encodes, %d uploads\n", *downloads, *encodes, *uploads)
 }
 
 func main() {
 	fs.Parse(os.Args[1:])
-	checkOptions()
 	m := synctool.NewManager(*secretsPath)
+	if cmd := fs.Arg(0); cmd != "" {
+		if err := m.LoadState(*statePath); err != nil {
+			log.Fatalln(err)
+		}
+		switch cmd {
+		case "dead":
+			runDead(m)
+		case "revive":
+			runRevive(m, fs.Args()[1:])
+		default:
+			log.Fatalf("unknown subcommand: %s\n", cmd)
+		}
+		return
+	}
+	checkOptions()
+	if *configPath != "" {
+		c, err := synctool.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		m.SetConfig(c)
+	}
+	m.SetChunkSize(*chunkSize)
 	err := m.Init()
 	if err != nil {
 		log.Fatalln(err)
 	}
+	if err := m.LoadState(*statePath); err != nil {
+		log.Fatalln(err)
+	}
 
-	t := time.NewTicker(*pollInterval)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p := newProcessor(m,
+		newStage(synctool.StageDownload, *downloads, m.RetryPolicy(synctool.StageDownload),
+			func(ctx context.Context, f *synctool.File) error { return download(ctx, m, f) }),
+		newStage(synctool.StageEncode, *encodes, m.RetryPolicy(synctool.StageEncode),
+			func(ctx context.Context, f *synctool.File) error { return encode(ctx, m, f) }),
+		newStage(synctool.StageUpload, *uploads, m.RetryPolicy(synctool.StageUpload),
+			func(ctx context.Context, f *synctool.File) error { return upload(ctx, m, f) }),
+	)
+	p.start(ctx)
+	go poll(m, p)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
 	pt := time.NewTicker(*pergeInterval)
-	ch := make(chan *synctool.File, 100)
-	checkNewFile(m, ch)
 	for {
 		select {
-		case c := <-t.C:
-			log.Println(m.NumFiles(), c)
-			checkNewFile(m, ch)
-			if err != nil {
-				log.Println(err)
-			}
-		case f := <-ch:
-			download(m, f, ch)
-			encode(m, f)
-			upload(m, f)
 		case <-pt.C:
 			m.Perge()
+		case s := <-sig:
+			log.Printf("%s received, shutting down\n", s)
+			p.shutdown(*grace, cancel)
+			if err := m.Save(); err != nil {
+				log.Fatalln(err)
+			}
+			return
 		}
 	}
 }
 
-func checkNewFile(m *synctool.Manager, ch chan<- *synctool.File) {
-	files, err := m.FindNewFiles()
+// poll feeds the files left unfinished in the previous run, the newly
+// uploaded files and the failed files into p until p is stopped.
+func poll(m *synctool.Manager, p *processor) {
+	p.feed(resume(m))
+	p.feed(checkNewFile(m))
+	t := time.NewTicker(*pollInterval)
+	defer t.Stop()
+	rt := time.NewTicker(retryCheckInterval)
+	defer rt.Stop()
+	for {
+		select {
+		case c := <-t.C:
+			log.Println(m.NumFiles(), c)
+			p.feed(checkNewFile(m))
+		case now := <-rt.C:
+			p.feed(p.takeRetry(now))
+		case <-p.stop:
+			return
+		}
+	}
+}
+
+// resume returns the files left unfinished in the previous run.
+func resume(m *synctool.Manager) []*synctool.File {
+	files, err := m.Resume()
 	if err != nil {
 		log.Println(err)
-		return
 	}
 	for _, f := range files {
-		ch <- f
+		log.Printf("resume: %s (downloaded: %v, encoded: %v, uploaded: %v)\n", f.Path, f.Downloaded, f.Encoded, f.Uploaded)
 	}
+	return files
 }
 
-func download(m *synctool.Manager, f *synctool.File, ch chan<- *synctool.File) {
-	if f == nil {
-		log.Println("download: f is nil")
-		return
+func checkNewFile(m *synctool.Manager) []*synctool.File {
+	files, err := m.FindNewFiles()
+	if err != nil {
+		log.Println(err)
+		return nil
 	}
+	return files
+}
+
+func download(ctx context.Context, m *synctool.Manager, f *synctool.File) error {
 	log.Printf("start: %s\n", f.ID)
-	n, path, err := m.Download(f.ID)
+	n, path, err := m.Download(ctx, f.ID)
 	if err != nil {
-		log.Printf("download failed: %s\n%s\n", f.ID, err)
-		ch <- f
-		return
+		return err
 	}
 	log.Printf("downloaded %v bytes: %v\n", n, path)
+	return nil
 }
 
-func encode(m *synctool.Manager, f *synctool.File) {
-	if f == nil {
-		log.Println("encode: f is nil")
-		return
-	}
+func encode(ctx context.Context, m *synctool.Manager, f *synctool.File) error {
 	log.Printf("encoding: %s\n", f.Path)
-	err := m.Encode(f.ID)
-	if err != nil {
-		log.Printf("encode failed: %s\n%s\n", f.ID, err)
-		return
+	if err := m.Encode(ctx, f.ID); err != nil {
+		return err
 	}
 	log.Printf("encoded %s\n", f.Path)
+	return nil
 }
 
-func upload(m *synctool.Manager, f *synctool.File) {
-	if f == nil {
-		log.Println("upload: f is nil")
-		return
-	}
-	encodedPath := f.Path + ".mp4"
-	df, err := m.Upload(encodedPath, "", []string{synctool.MP4TargetFolderID})
-	if err != nil {
-		log.Printf("upload failed: %v\n%v\n", f.ID, err)
-		return
+func upload(ctx context.Context, m *synctool.Manager, f *synctool.File) error {
+	if !f.Uploaded {
+		o, err := m.UploadEncoded(ctx, f.ID)
+		if err != nil {
+			return err
+		}
+		log.Printf("uploaded %v\n%v\n", f.EncodedPath, o.URL)
 	}
-	log.Printf("uploaded %v\n%v\n", encodedPath, fmt.Sprintf(synctool.GoogleDriveOpenURL, df.Id))
-	err = m.Move(f.ID)
-	if err != nil {
-		log.Printf("move failed: %s\n%s\n", f.ID, err)
-		return
+	if err := m.Move(f.ID); err != nil {
+		return fmt.Errorf("move: %v", err)
 	}
 	log.Printf("moved %s to encode done folder\n", f.Path)
+	return nil
 }
@@ -0,0 +1,222 @@
+//    Copyright 2017 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/sync-tool"
+)
+
+// stage is a step of processing files run by the fixed number of workers.
+type stage struct {
+	name    string
+	workers int
+	policy  synctool.RetryPolicy
+	in      chan *synctool.File
+	run     func(ctx context.Context, f *synctool.File) error
+}
+
+func newStage(name string, workers int, policy synctool.RetryPolicy, run func(context.Context, *synctool.File) error) *stage {
+	if workers < 1 {
+		workers = 1
+	}
+	return &stage{
+		name:    name,
+		workers: workers,
+		policy:  policy,
+		in:      make(chan *synctool.File, workers),
+		run:     run,
+	}
+}
+
+// processor passes files through download, encode and upload stages. Each
+// stage blocks the previous one when all of its workers are busy, so that
+// files are not downloaded much faster than they are encoded. Failed files
+// are retried with backoff, and given up after the max attempts of the stage.
+type processor struct {
+	m        *synctool.Manager
+	download *stage
+	encode   *stage
+	upload   *stage
+
+	// stop is closed on shutdown. Workers finish the file in hand and take
+	// no more files after that.
+	stop chan struct{}
+	wg   sync.WaitGroup
+
+	// mu protects retry.
+	mu    sync.Mutex
+	retry []retry
+}
+
+// retry is the failed file to be dispatched again after at.
+type retry struct {
+	f  *synctool.File
+	at time.Time
+}
+
+func newProcessor(m *synctool.Manager, download, encode, upload *stage) *processor {
+	return &processor{
+		m:        m,
+		download: download,
+		encode:   encode,
+		upload:   upload,
+		stop:     make(chan struct{}),
+	}
+}
+
+// start runs the workers of all stages. ctx is given to the running tasks
+// so that they are aborted when it is canceled.
+func (p *processor) start(ctx context.Context) {
+	for _, s := range []*stage{p.download, p.encode, p.upload} {
+		for i := 0; i < s.workers; i++ {
+			p.wg.Add(1)
+			go p.work(ctx, s)
+		}
+	}
+}
+
+// next returns the stage to process f, or nil if f is completed.
+func (p *processor) next(f *synctool.File) *stage {
+	switch {
+	case !f.Downloaded:
+		return p.download
+	case !f.Encoded:
+		return p.encode
+	case !f.Moved:
+		return p.upload
+	}
+	return nil
+}
+
+// dispatch passes f to the stage to process it. It blocks until the stage
+// accepts f, and returns false if the processor is stopped in the meantime.
+func (p *processor) dispatch(f *synctool.File) bool {
+	s := p.next(f)
+	if s == nil {
+		return true
+	}
+	select {
+	case <-p.stop:
+		return false
+	default:
+	}
+	select {
+	case s.in <- f:
+		return true
+	case <-p.stop:
+		return false
+	}
+}
+
+// feed dispatches files in order until the processor is stopped.
+func (p *processor) feed(files []*synctool.File) {
+	for _, f := range files {
+		if !p.dispatch(f) {
+			return
+		}
+	}
+}
+
+// takeRetry returns the failed files to be retried by now.
+func (p *processor) takeRetry(now time.Time) []*synctool.File {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	files := []*synctool.File{}
+	left := p.retry[:0]
+	for _, r := range p.retry {
+		if r.at.After(now) {
+			left = append(left, r)
+			continue
+		}
+		files = append(files, r.f)
+	}
+	p.retry = left
+	return files
+}
+
+// fail records the failure of f in s, and schedules the retry unless f is
+// given up.
+func (p *processor) fail(s *stage, f *synctool.File, err error) {
+	log.Printf("%s failed: %s\n%s\n", s.name, f.ID, err)
+	d, serr := p.m.Fail(f, s.name, err, s.policy)
+	if serr != nil {
+		log.Println(serr)
+	}
+	if f.Dead {
+		log.Printf("%s gave up %s after %d attempts\n", s.name, f.Path, f.Attempts)
+		return
+	}
+	log.Printf("%s will retry %s in %s (attempt %d of %d)\n", s.name, f.ID, d, f.Attempts+1, s.policy.MaxAttempts)
+	p.mu.Lock()
+	p.retry = append(p.retry, retry{f: f, at: time.Now().Add(d)})
+	p.mu.Unlock()
+}
+
+func (p *processor) work(ctx context.Context, s *stage) {
+	defer p.wg.Done()
+	for {
+		select {
+		case <-p.stop:
+			return
+		case f := <-s.in:
+			select {
+			case <-p.stop:
+				// the state of f is already saved, so it is resumed on next run.
+				return
+			default:
+			}
+			if f == nil {
+				log.Printf("%s: f is nil\n", s.name)
+				continue
+			}
+			if err := s.run(ctx, f); err != nil {
+				if ctx.Err() != nil {
+					// aborted on shutdown, not counted as a failure.
+					continue
+				}
+				p.fail(s, f, err)
+				continue
+			}
+			if err := p.m.Succeed(f); err != nil {
+				log.Println(err)
+			}
+			p.dispatch(f)
+		}
+	}
+}
+
+// shutdown stops the processor and waits for the running tasks to finish
+// until grace has passed. The tasks still running after that are aborted by
+// cancel.
+func (p *processor) shutdown(grace time.Duration, cancel context.CancelFunc) {
+	close(p.stop)
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(grace):
+		log.Printf("aborting tasks still running after %s\n", grace)
+		cancel()
+		<-done
+	}
+}
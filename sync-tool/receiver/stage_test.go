@@ -0,0 +1,96 @@
+//    Copyright 2017 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/sync-tool"
+)
+
+func Test_processor(t *testing.T) {
+	var mu sync.Mutex
+	running, max := 0, 0
+	done := make(chan *synctool.File, 10)
+	failed := map[string]bool{}
+	run := func(set func(f *synctool.File)) func(context.Context, *synctool.File) error {
+		return func(ctx context.Context, f *synctool.File) error {
+			mu.Lock()
+			running++
+			if running > max {
+				max = running
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			defer mu.Unlock()
+			running--
+			if f.ID == "flaky" && !failed[f.ID] {
+				failed[f.ID] = true
+				return fmt.Errorf("temporary error")
+			}
+			set(f)
+			return nil
+		}
+	}
+	policy := synctool.RetryPolicy{MaxAttempts: 2, Backoff: time.Minute}
+	p := newProcessor(synctool.NewManager(""),
+		newStage("download", 2, policy, run(func(f *synctool.File) { f.Downloaded = true })),
+		newStage("encode", 1, policy, run(func(f *synctool.File) { f.Encoded = true })),
+		newStage("upload", 3, policy, run(func(f *synctool.File) { f.Uploaded, f.Moved = true, true; done <- f })),
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p.start(ctx)
+
+	files := []*synctool.File{
+		synctool.NewFile("a.ts", "a"),
+		synctool.NewFile("b.ts", "b"),
+		synctool.NewFile("flaky.ts", "flaky"),
+		{Path: "c.ts", ID: "c", Downloaded: true, Encoded: true, Uploaded: true},
+	}
+	p.feed(files)
+	for i := 0; i < 3; i++ {
+		<-done
+	}
+	if retry := p.takeRetry(time.Now()); len(retry) != 0 {
+		t.Fatalf("want: no retry before backoff, out: %v", retry)
+	}
+	retry := p.takeRetry(time.Now().Add(time.Minute))
+	if len(retry) != 1 || retry[0].ID != "flaky" || retry[0].Attempts != 1 || retry[0].Dead {
+		t.Fatalf("want: [flaky], out: %v", retry)
+	}
+	p.feed(retry)
+	if f := <-done; f.Attempts != 0 || f.LastError != "" {
+		t.Fatalf("want: failures cleared, out: %v", f)
+	}
+	p.shutdown(time.Second, cancel)
+
+	for _, f := range files {
+		if !f.Moved {
+			t.Fatalf("want: moved, out: %v", f)
+		}
+	}
+	if max > 6 {
+		t.Fatalf("want: <= 6 running, out: %d", max)
+	}
+	if p.dispatch(synctool.NewFile("d.ts", "d")) {
+		t.Fatalf("want: false after shutdown, out: true")
+	}
+}
@@ -0,0 +1,130 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// Names of the stages to process a file in receiver.
+const (
+	StageDownload = "download"
+	StageEncode   = "encode"
+	StageUpload   = "upload"
+)
+
+// RetryPolicy decides how many times and how often a failed stage is retried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts before the file is given up.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Backoff is the delay before the first retry. It is doubled on each
+	// failure up to MaxBackoff.
+	Backoff    time.Duration `yaml:"backoff"`
+	MaxBackoff time.Duration `yaml:"max_backoff"`
+}
+
+// DefaultRetryPolicy is used for the stages without retry config.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 5,
+	Backoff:     1 * time.Minute,
+	MaxBackoff:  1 * time.Hour,
+}
+
+// Delay returns the delay before the retry after attempts failures.
+func (p RetryPolicy) Delay(attempts int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < attempts && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+func (p RetryPolicy) validate() error {
+	if p.MaxAttempts < 1 {
+		return fmt.Errorf("max_attempts must be positive")
+	}
+	if p.Backoff < 0 || p.MaxBackoff < 0 {
+		return fmt.Errorf("backoff must not be negative")
+	}
+	return nil
+}
+
+// Fail records the failure of stage for f, and returns the delay before
+// the retry. f is marked as dead if it has failed p.MaxAttempts times.
+func (m *Manager) Fail(f *File, stage string, cause error, p RetryPolicy) (time.Duration, error) {
+	var d time.Duration
+	err := m.update(func() {
+		if f.Stage != stage {
+			f.Attempts = 0
+		}
+		f.Stage = stage
+		f.Attempts++
+		f.LastError = cause.Error()
+		f.Dead = f.Attempts >= p.MaxAttempts
+		d = p.Delay(f.Attempts)
+	})
+	return d, err
+}
+
+// Succeed clears the failures recorded for f.
+func (m *Manager) Succeed(f *File) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f.Attempts == 0 && f.Stage == "" {
+		return nil
+	}
+	f.Stage = ""
+	f.Attempts = 0
+	f.LastError = ""
+	return m.save()
+}
+
+// DeadLetters returns the files given up after failing too many times.
+func (m *Manager) DeadLetters() []*File {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	files := []*File{}
+	for _, f := range m.files {
+		if f != nil && f.Dead {
+			files = append(files, f)
+		}
+	}
+	return files
+}
+
+// Revive clears the failures of the dead file whose ID, path or filename is
+// key so that it is processed again on next run.
+func (m *Manager) Revive(key string) (*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.files {
+		if f == nil || !f.Dead {
+			continue
+		}
+		if f.ID == key || f.Path == key || filepath.Base(f.Path) == key {
+			f.Dead = false
+			f.Stage = ""
+			f.Attempts = 0
+			f.LastError = ""
+			return f, m.save()
+		}
+	}
+	return nil, fmt.Errorf("no dead file matches %v", key)
+}
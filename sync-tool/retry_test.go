@@ -0,0 +1,68 @@
+//    Copyright 2017 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_RetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{MaxAttempts: 10, Backoff: time.Minute, MaxBackoff: 10 * time.Minute}
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{100, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if out := p.Delay(tt.attempts); out != tt.want {
+			t.Fatalf("want: %s, out: %s", tt.want, out)
+		}
+	}
+}
+
+func Test_DeadLetters(t *testing.T) {
+	m := NewManager("")
+	f := NewFile("/rec/a.ts", "a")
+	m.AddFile(f)
+	m.AddFile(NewFile("/rec/b.ts", "b"))
+	p := RetryPolicy{MaxAttempts: 2, Backoff: time.Second}
+	m.Fail(f, StageDownload, fmt.Errorf("e1"), p)
+	// failures are counted per stage.
+	m.Fail(f, StageEncode, fmt.Errorf("e2"), p)
+	if f.Dead || f.Attempts != 1 {
+		t.Fatalf("want: alive with 1 attempt, out: %v", f)
+	}
+	m.Fail(f, StageEncode, fmt.Errorf("e3"), p)
+	dead := m.DeadLetters()
+	if len(dead) != 1 || dead[0] != f || f.LastError != "e3" {
+		t.Fatalf("want: [a], out: %v", dead)
+	}
+	if pending, _ := m.Resume(); len(pending) != 1 || pending[0].ID != "b" {
+		t.Fatalf("want: [b], out: %v", pending)
+	}
+	if _, err := m.Revive("a.ts"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if f.Dead || f.Attempts != 0 || len(m.DeadLetters()) != 0 {
+		t.Fatalf("want: revived, out: %v", f)
+	}
+}
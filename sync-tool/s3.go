@@ -0,0 +1,637 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// s3MinPartSize is the minimum size of the parts of multipart uploads
+	// except the last one.
+	s3MinPartSize = 5 << 20
+
+	// s3MaxCopySize is the maximum size of the object copied in a request.
+	// Larger objects are copied in parts of s3CopyPartSize.
+	s3MaxCopySize  = 5 << 30
+	s3CopyPartSize = 1 << 30
+)
+
+// s3Storage is Storage on Amazon S3 or the compatible services such as
+// MinIO. Requests are signed with AWS Signature Version 4. The checksums
+// given by the uploader are recorded in the user metadata, and each request
+// has Content-MD5 so that S3 rejects the corrupted content.
+type s3Storage struct {
+	endpoint  string
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	partSize  int64
+	client    *http.Client
+	now       func() time.Time
+}
+
+func newS3Storage(c StorageConfig, chunkSize int64) (*s3Storage, error) {
+	u, err := url.Parse(c.Endpoint)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("s3: invalid endpoint %q", c.Endpoint)
+	}
+	s := &s3Storage{
+		endpoint:  strings.TrimSuffix(c.Endpoint, "/"),
+		region:    c.Region,
+		bucket:    c.Bucket,
+		accessKey: c.AccessKey,
+		secretKey: c.SecretKey,
+		partSize:  chunkSize,
+		client:    http.DefaultClient,
+		now:       time.Now,
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.accessKey == "" {
+		s.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if s.secretKey == "" {
+		s.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("s3: access key and secret key are required")
+	}
+	if s.partSize < s3MinPartSize {
+		s.partSize = s3MinPartSize
+	}
+	return s, nil
+}
+
+// s3Key returns the key of the object named name in folder.
+func s3Key(folder, name string) string {
+	if folder == "" {
+		return name
+	}
+	return strings.TrimSuffix(folder, "/") + "/" + name
+}
+
+// s3MD5 returns the MD5 checksum from ETag. ETag of the object uploaded in
+// parts is not MD5, and empty string is returned.
+func s3MD5(etag string) string {
+	etag = strings.Trim(etag, `"`)
+	if strings.Contains(etag, "-") {
+		return ""
+	}
+	return etag
+}
+
+// object returns Object of key. h is the response header of the object
+// with the user metadata, or nil if not available.
+func (s *s3Storage) object(key string, size int64, etag string, h http.Header) *Object {
+	o := &Object{
+		ID:   key,
+		Name: path.Base(key),
+		Size: size,
+		URL:  "s3://" + s.bucket + "/" + key,
+	}
+	o.MD5 = s3MD5(etag)
+	if h != nil {
+		o.SHA256 = h.Get("X-Amz-Meta-Sha256")
+		if o.MD5 == "" {
+			o.MD5 = h.Get("X-Amz-Meta-Md5")
+		}
+	}
+	return o
+}
+
+// metaHeader returns the header to record sums in the user metadata.
+func metaHeader(sums Checksums) http.Header {
+	h := http.Header{}
+	if sums.MD5 != "" {
+		h.Set("X-Amz-Meta-Md5", sums.MD5)
+	}
+	if sums.SHA256 != "" {
+		h.Set("X-Amz-Meta-Sha256", sums.SHA256)
+	}
+	return h
+}
+
+// contentMD5 returns the value of Content-MD5 header of n bytes of f from
+// off.
+func contentMD5(f *os.File, off, n int64) (string, error) {
+	h := md5.New()
+	if _, err := io.Copy(h, io.NewSectionReader(f, off, n)); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
+
+// do sends the signed request for the object with key. The key is empty for
+// the requests to the bucket. The response with non-2xx status is returned
+// as error.
+func (s *s3Storage) do(ctx context.Context, method, key string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	uri := "/" + uriEncode(s.bucket, true)
+	if key != "" {
+		uri += "/" + uriEncode(key, false)
+	}
+	q := canonicalQuery(query)
+	u := s.endpoint + uri
+	if q != "" {
+		u += "?" + q
+	}
+	req, err := http.NewRequest(method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.ContentLength = size
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	signV4(req, uri, q, s.accessKey, s.secretKey, s.region, s.now())
+	res, err := s.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode/100 != 2 {
+		defer res.Body.Close()
+		return nil, s3ResponseError(method+" "+key, res)
+	}
+	return res, nil
+}
+
+// s3Error is the error response of S3.
+type s3Error struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// s3StatusError is the response with non-2xx status.
+type s3StatusError struct {
+	op     string
+	status string
+	s3Error
+}
+
+func (e *s3StatusError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("s3: %s: %s: %s: %s", e.op, e.status, e.Code, e.Message)
+	}
+	return fmt.Sprintf("s3: %s: %s", e.op, e.status)
+}
+
+func s3ResponseError(op string, res *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 4096))
+	e := &s3StatusError{op: op, status: res.Status}
+	xml.Unmarshal(b, &e.s3Error)
+	return e
+}
+
+// decode reads the XML response of res into v. S3 may return an error with
+// 200 status for the long running requests, so it is checked as well.
+func decode(op string, res *http.Response, v interface{}) error {
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	var e struct {
+		XMLName xml.Name
+		s3Error
+	}
+	if xml.Unmarshal(b, &e) == nil && e.XMLName.Local == "Error" {
+		return fmt.Errorf("s3: %s: %s: %s", op, e.Code, e.Message)
+	}
+	if v == nil {
+		return nil
+	}
+	return xml.Unmarshal(b, v)
+}
+
+func (s *s3Storage) List(ctx context.Context, folder string) ([]*Object, error) {
+	prefix := ""
+	if folder != "" {
+		prefix = strings.TrimSuffix(folder, "/") + "/"
+	}
+	objs := []*Object{}
+	token := ""
+	for {
+		q := url.Values{"list-type": {"2"}, "prefix": {prefix}, "delimiter": {"/"}}
+		if token != "" {
+			q.Set("continuation-token", token)
+		}
+		res, err := s.do(ctx, "GET", "", q, nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var l struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key  string `xml:"Key"`
+				Size int64  `xml:"Size"`
+				ETag string `xml:"ETag"`
+			} `xml:"Contents"`
+		}
+		if err := decode("list "+prefix, res, &l); err != nil {
+			return nil, err
+		}
+		for _, c := range l.Contents {
+			if strings.HasSuffix(c.Key, "/") {
+				continue
+			}
+			objs = append(objs, s.object(c.Key, c.Size, c.ETag, nil))
+		}
+		if !l.IsTruncated {
+			return objs, nil
+		}
+		token = l.NextContinuationToken
+	}
+}
+
+func (s *s3Storage) Stat(ctx context.Context, id string) (*Object, error) {
+	res, err := s.do(ctx, "HEAD", id, nil, nil, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	res.Body.Close()
+	return s.object(id, res.ContentLength, res.Header.Get("ETag"), res.Header), nil
+}
+
+func (s *s3Storage) Open(ctx context.Context, id string, off int64) (io.ReadCloser, error) {
+	h := http.Header{}
+	if off > 0 {
+		h.Set("Range", fmt.Sprintf("bytes=%d-", off))
+	}
+	res, err := s.do(ctx, "GET", id, nil, nil, 0, h)
+	if err != nil {
+		return nil, err
+	}
+	if off > 0 && res.StatusCode != http.StatusPartialContent {
+		if _, err := io.CopyN(ioutil.Discard, res.Body, off); err != nil {
+			res.Body.Close()
+			return nil, err
+		}
+	}
+	return res.Body, nil
+}
+
+// Upload puts the file in a request if it fits in a part, or uploads it in
+// parts otherwise. The session is the upload ID of the multipart upload.
+func (s *s3Storage) Upload(ctx context.Context, p, folder, session string, save func(string) error, sums Checksums) (*Object, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fi.Size()
+	key := s3Key(folder, filepath.Base(p))
+	if size <= s.partSize && session == "" {
+		h := metaHeader(sums)
+		sum, err := contentMD5(f, 0, size)
+		if err != nil {
+			return nil, err
+		}
+		h.Set("Content-MD5", sum)
+		res, err := s.do(ctx, "PUT", key, nil, io.NewSectionReader(f, 0, size), size, h)
+		if err != nil {
+			return nil, err
+		}
+		res.Body.Close()
+		o := s.object(key, size, res.Header.Get("ETag"), nil)
+		o.SHA256 = sums.SHA256
+		return o, nil
+	}
+
+	var parts []s3Part
+	if session != "" {
+		parts, err = s.listParts(ctx, key, session)
+		if e, ok := err.(*s3StatusError); ok && e.Code == "NoSuchUpload" {
+			// the upload is aborted or expired.
+			session = ""
+		} else if err != nil {
+			return nil, err
+		}
+	}
+	if session == "" {
+		if session, err = s.initiate(ctx, key, metaHeader(sums)); err != nil {
+			return nil, err
+		}
+		if save != nil {
+			if err := save(session); err != nil {
+				return nil, err
+			}
+		}
+		parts = nil
+	}
+	var off int64
+	for _, pt := range parts {
+		off += pt.Size
+	}
+	for off < size {
+		n := s.partSize
+		if n > size-off {
+			n = size - off
+		}
+		pt := s3Part{Number: len(parts) + 1, Size: n}
+		q := url.Values{"partNumber": {strconv.Itoa(pt.Number)}, "uploadId": {session}}
+		sum, err := contentMD5(f, off, n)
+		if err != nil {
+			return nil, err
+		}
+		h := http.Header{"Content-Md5": {sum}}
+		for i := 0; ; i++ {
+			var res *http.Response
+			res, err = s.do(ctx, "PUT", key, q, io.NewSectionReader(f, off, n), n, h)
+			if err == nil {
+				res.Body.Close()
+				pt.ETag = res.Header.Get("ETag")
+				break
+			}
+			if ctx.Err() != nil || i >= maxTransferRetries {
+				return nil, err
+			}
+			if err := backoff(ctx, i+1); err != nil {
+				return nil, err
+			}
+		}
+		parts = append(parts, pt)
+		off += n
+	}
+	if err := s.complete(ctx, key, session, parts); err != nil {
+		return nil, err
+	}
+	// ETag of the multipart upload is not MD5, but each part has been
+	// checked with Content-MD5.
+	o := s.object(key, size, "", nil)
+	o.SHA256 = sums.SHA256
+	return o, nil
+}
+
+// Move copies the object and deletes the original because S3 has no move.
+func (s *s3Storage) Move(ctx context.Context, id, from, to string) error {
+	o, err := s.Stat(ctx, id)
+	if err != nil {
+		return err
+	}
+	dst := s3Key(to, path.Base(id))
+	src := "/" + uriEncode(s.bucket, true) + "/" + uriEncode(id, false)
+	if o.Size <= s3MaxCopySize {
+		h := http.Header{"X-Amz-Copy-Source": {src}}
+		res, err := s.do(ctx, "PUT", dst, nil, nil, 0, h)
+		if err != nil {
+			return err
+		}
+		if err := decode("copy "+id, res, nil); err != nil {
+			return err
+		}
+	} else {
+		uploadID, err := s.initiate(ctx, dst, metaHeader(o.Checksums))
+		if err != nil {
+			return err
+		}
+		parts := []s3Part{}
+		for off := int64(0); off < o.Size; off += s3CopyPartSize {
+			end := off + s3CopyPartSize
+			if end > o.Size {
+				end = o.Size
+			}
+			pt := s3Part{Number: len(parts) + 1, Size: end - off}
+			q := url.Values{"partNumber": {strconv.Itoa(pt.Number)}, "uploadId": {uploadID}}
+			h := http.Header{
+				"X-Amz-Copy-Source":       {src},
+				"X-Amz-Copy-Source-Range": {fmt.Sprintf("bytes=%d-%d", off, end-1)},
+			}
+			res, err := s.do(ctx, "PUT", dst, q, nil, 0, h)
+			if err != nil {
+				return err
+			}
+			var r struct {
+				ETag string `xml:"ETag"`
+			}
+			if err := decode("copy "+id, res, &r); err != nil {
+				return err
+			}
+			pt.ETag = r.ETag
+			parts = append(parts, pt)
+		}
+		if err := s.complete(ctx, dst, uploadID, parts); err != nil {
+			return err
+		}
+	}
+	return s.Delete(ctx, id)
+}
+
+func (s *s3Storage) Delete(ctx context.Context, id string) error {
+	res, err := s.do(ctx, "DELETE", id, nil, nil, 0, nil)
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+	return nil
+}
+
+// s3Part is a part of the multipart upload.
+type s3Part struct {
+	Number int    `xml:"PartNumber"`
+	ETag   string `xml:"ETag"`
+	Size   int64  `xml:"Size"`
+}
+
+// initiate starts the multipart upload of key with the header h, and
+// returns the upload ID.
+func (s *s3Storage) initiate(ctx context.Context, key string, h http.Header) (string, error) {
+	res, err := s.do(ctx, "POST", key, url.Values{"uploads": {""}}, nil, 0, h)
+	if err != nil {
+		return "", err
+	}
+	var r struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := decode("initiate "+key, res, &r); err != nil {
+		return "", err
+	}
+	return r.UploadID, nil
+}
+
+// listParts returns the parts already uploaded in the upload.
+func (s *s3Storage) listParts(ctx context.Context, key, uploadID string) ([]s3Part, error) {
+	parts := []s3Part{}
+	marker := ""
+	for {
+		q := url.Values{"uploadId": {uploadID}}
+		if marker != "" {
+			q.Set("part-number-marker", marker)
+		}
+		res, err := s.do(ctx, "GET", key, q, nil, 0, nil)
+		if err != nil {
+			return nil, err
+		}
+		var r struct {
+			IsTruncated          bool     `xml:"IsTruncated"`
+			NextPartNumberMarker string   `xml:"NextPartNumberMarker"`
+			Parts                []s3Part `xml:"Part"`
+		}
+		if err := decode("list parts "+key, res, &r); err != nil {
+			return nil, err
+		}
+		parts = append(parts, r.Parts...)
+		if !r.IsTruncated {
+			break
+		}
+		marker = r.NextPartNumberMarker
+	}
+	// only the consecutive parts from the first are used.
+	sort.Slice(parts, func(i, j int) bool { return parts[i].Number < parts[j].Number })
+	for i, pt := range parts {
+		if pt.Number != i+1 {
+			return parts[:i], nil
+		}
+	}
+	return parts, nil
+}
+
+// complete finishes the multipart upload with parts.
+func (s *s3Storage) complete(ctx context.Context, key, uploadID string, parts []s3Part) error {
+	type part struct {
+		Number int    `xml:"PartNumber"`
+		ETag   string `xml:"ETag"`
+	}
+	body := struct {
+		XMLName xml.Name `xml:"CompleteMultipartUpload"`
+		Parts   []part   `xml:"Part"`
+	}{}
+	for _, pt := range parts {
+		body.Parts = append(body.Parts, part{pt.Number, pt.ETag})
+	}
+	b, err := xml.Marshal(body)
+	if err != nil {
+		return err
+	}
+	res, err := s.do(ctx, "POST", key, url.Values{"uploadId": {uploadID}}, bytes.NewReader(b), int64(len(b)), nil)
+	if err != nil {
+		return err
+	}
+	return decode("complete "+key, res, nil)
+}
+
+// signV4 signs req with AWS Signature Version 4. uri and query are the
+// canonical forms of the path and the query of req. The payload is not
+// signed unless X-Amz-Content-Sha256 is set in advance.
+func signV4(req *http.Request, uri, query, accessKey, secretKey, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	payload := req.Header.Get("X-Amz-Content-Sha256")
+	if payload == "" {
+		payload = "UNSIGNED-PAYLOAD"
+		req.Header.Set("X-Amz-Content-Sha256", payload)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		vs := make([]string, len(v))
+		for i := range v {
+			vs[i] = strings.Join(strings.Fields(v[i]), " ")
+		}
+		headers[strings.ToLower(k)] = strings.Join(vs, ",")
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonical strings.Builder
+	fmt.Fprintf(&canonical, "%s\n%s\n%s\n", req.Method, uri, query)
+	for _, k := range names {
+		fmt.Fprintf(&canonical, "%s:%s\n", k, headers[k])
+	}
+	signed := strings.Join(names, ";")
+	fmt.Fprintf(&canonical, "\n%s\n%s", signed, payload)
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	sum := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+	key := []byte("AWS4" + secretKey)
+	for _, s := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query sorted by the keys and encoded as
+// Signature Version 4 requires.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := []string{}
+	for _, k := range keys {
+		for _, v := range q[k] {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode escapes s except the unreserved characters, and "/" unless
+// encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -15,13 +15,15 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rjeczalik/notify"
@@ -32,6 +34,9 @@ var (
 	fs            *flag.FlagSet
 	pergeInterval *time.Duration
 	secretsPath   *string
+	statePath     *string
+	configPath    *string
+	keep          *bool
 )
 
 const (
@@ -42,6 +47,9 @@ func init() {
 	fs = flag.NewFlagSet("base", flag.ExitOnError)
 	pergeInterval = fs.Duration("perge", DefaultPergeInterval, "perge interval duration")
 	secretsPath = fs.String("secrets", synctool.DefaultSecretsFile, "path to client_secret.json")
+	statePath = fs.String("state", synctool.DefaultStateFile, "path to the file to persist the state of files")
+	configPath = fs.String("config", "", "path to the pipelines config file (default: built-in folder IDs)")
+	keep = fs.Bool("keep", false, "keep the original files after they are encoded, to be removed by trash -sync-state")
 }
 
 func main() {
@@ -57,58 +65,110 @@ func main() {
 	defer notify.Stop(c)
 
 	tick := time.NewTicker(*pergeInterval)
-	m := synctool.NewManager(synctool.DefaultSecretsFile) // TODO: replace file name with cli args
+	m := synctool.NewManager(*secretsPath)
+	if *configPath != "" {
+		c, err := synctool.LoadConfig(*configPath)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		m.SetConfig(c)
+	}
+	m.SetKeepOriginals(*keep)
 	err := m.Init()
 	if err != nil {
 		log.Fatalln(err)
 	}
+	// the files uploaded in the previous run are kept to be perged.
+	if err := m.LoadState(*statePath); err != nil {
+		log.Fatalln(err)
+	}
 
-	uploadAll(m)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	kick := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go uploader(ctx, m, kick, done)
+
+	addAll(m)
+	request(kick)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
 	for {
 		select {
 		case ei := <-c:
 			switch {
 			case ei.Event() == notify.InCloseWrite:
+				if !strings.HasSuffix(ei.Path(), ".ts") {
+					continue
+				}
 				log.Printf("Writing to %s is done!", ei.Path())
-				go upload(m, ei.Path())
+				if err := m.SenderAdd(ei.Path()); err != nil {
+					log.Println(err)
+					continue
+				}
+				request(kick)
 			case ei.Event() == notify.InCreate:
 				log.Printf("File %s is created!", ei.Path())
 			}
 		case <-tick.C:
 			update(m)
+			request(kick)
+		case s := <-sig:
+			// the upload in progress is aborted, and resumed on next run.
+			log.Printf("%s received, shutting down\n", s)
+			cancel()
+			<-done
+			return
 		}
 	}
 }
 
-func uploadAll(m *synctool.Manager) {
+// addAll registers the files in the current directory to be uploaded.
+func addAll(m *synctool.Manager) {
 	cwd, err := os.Getwd()
 	if err != nil {
 		log.Fatalln(err)
 	}
 	files, err := ioutil.ReadDir(cwd)
+	if err != nil {
+		log.Fatalln(err)
+	}
 	for _, f := range files {
 		path := filepath.Join(cwd, f.Name())
-		err := upload(m, path)
-		if err != nil {
+		if !strings.HasSuffix(path, ".ts") {
+			log.Printf("ignoring %v from upload target.", path)
+			continue
+		}
+		if err := m.SenderAdd(path); err != nil {
 			log.Println(err)
 		}
 	}
 }
 
-func upload(m *synctool.Manager, path string) error {
-	if !strings.HasSuffix(path, ".ts") {
-		return fmt.Errorf("ignoring %v from upload target.", path)
+// uploader uploads the registered files each time kick is notified until ctx
+// is canceled. Uploads are done one by one in this goroutine since
+// SenderUpload must not run concurrently.
+func uploader(ctx context.Context, m *synctool.Manager, kick <-chan struct{}, done chan<- struct{}) {
+	defer close(done)
+	for {
+		select {
+		case <-kick:
+			if err := m.SenderUpload(ctx); err != nil {
+				log.Println(err)
+			}
+		case <-ctx.Done():
+			return
+		}
 	}
-	res, err := m.Upload(path, "", []string{synctool.UploadTargetFolderID})
-	if err != nil {
-		return err
-	} else {
-		log.Println(synctool.Loginfo(res))
+}
+
+// request notifies kick without blocking. The notification already pending
+// covers the new files as well.
+func request(kick chan<- struct{}) {
+	select {
+	case kick <- struct{}{}:
+	default:
 	}
-	f := synctool.NewFile(path, res.Id)
-	f.Uploaded = true
-	m.AddFile(f)
-	return nil
 }
 
 func update(m *synctool.Manager) {
@@ -116,6 +176,4 @@ func update(m *synctool.Manager) {
 	if err != nil {
 		log.Println(err)
 	}
-	// TODO: SenderUpload is uploading already uploaded videos.
-	// m.SenderUpload()
 }
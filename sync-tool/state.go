@@ -0,0 +1,168 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultStateFile is the filename of JSON file where the lifecycle of
+	// the files is persisted.
+	DefaultStateFile = "sync-state.json"
+
+	// MinEncodedRatio is the minimum ratio of the duration of the encoded file
+	// to the original to regard the encoding as completed.
+	MinEncodedRatio = 0.95
+)
+
+// state is the content of the state file.
+type state struct {
+	Files []*File `json:"files"`
+}
+
+// LoadState reads the files from the state file at path, and saves the
+// changes of the files into it afterwards. It starts with no file if the
+// state file doesn't exist.
+func (m *Manager) LoadState(path string) error {
+	m.statePath = path
+	files, err := ReadState(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.mu.Lock()
+	m.files = files
+	m.mu.Unlock()
+	return nil
+}
+
+// ReadState returns the files recorded in the state file at path.
+func ReadState(path string) ([]*File, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s state
+	if err := json.Unmarshal(b, &s); err != nil {
+		return nil, fmt.Errorf("invalid state file %v: %v", path, err)
+	}
+	return s.Files, nil
+}
+
+// Save writes the files into the state file. It does nothing if LoadState
+// has not been called. The state file is written into a temporary file and
+// renamed so that it is never left half written.
+func (m *Manager) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.save()
+}
+
+// save is Save without the lock.
+func (m *Manager) save() error {
+	if m.statePath == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(&state{Files: m.files}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(m.statePath), filepath.Base(m.statePath)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), m.statePath)
+}
+
+// Resume checks the files restored from the state file against the local
+// files, resets the stages not actually finished, and returns the files to
+// be processed again except the dead ones. Downloads are redone if the file
+// is missing or its size differs, and encodes are redone if the encoded file
+// is missing or shorter than the original.
+func (m *Manager) Resume() ([]*File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	pending := []*File{}
+	for _, f := range m.files {
+		if f == nil || f.Moved || f.Dead {
+			continue
+		}
+		if f.Downloaded {
+			fi, err := os.Stat(f.Path)
+			if err != nil || (f.Size > 0 && fi.Size() != f.Size) {
+				f.Downloaded = false
+				f.Encoded = false
+			}
+		}
+		if f.Encoded && !encodeCompleted(f.Path, f.EncodedPath) {
+			f.Encoded = false
+			f.Uploaded = false
+		}
+		pending = append(pending, f)
+	}
+	return pending, m.save()
+}
+
+// encodeCompleted returns true if dst encoded from src exists and its
+// duration is long enough compared with src.
+func encodeCompleted(src, dst string) bool {
+	if _, err := os.Stat(dst); err != nil {
+		return false
+	}
+	s, err := probeDuration(src)
+	if err != nil {
+		return false
+	}
+	d, err := probeDuration(dst)
+	if err != nil {
+		return false
+	}
+	return float64(d) >= float64(s)*MinEncodedRatio
+}
+
+// probeDuration returns the duration of the media file at path with ffprobe.
+var probeDuration = func(path string) (time.Duration, error) {
+	out, err := exec.Command("ffprobe", "-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %v: %v", path, err)
+	}
+	sec, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %v: invalid duration %q", path, out)
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
@@ -0,0 +1,88 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Resume(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	write := func(name string, size int) string {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		return path
+	}
+	defer func(f func(string) (time.Duration, error)) { probeDuration = f }(probeDuration)
+	probeDuration = func(path string) (time.Duration, error) {
+		if strings.HasSuffix(path, "truncated.ts.mp4") {
+			return 10 * time.Minute, nil
+		}
+		return 30 * time.Minute, nil
+	}
+
+	done := write("done.ts", 10)
+	partial := filepath.Join(dir, "partial.ts")
+	write("partial.ts.part", 5)
+	encoded := write("encoded.ts", 10)
+	write("encoded.ts.mp4", 5)
+	truncated := write("truncated.ts", 10)
+	write("truncated.ts.mp4", 5)
+
+	statePath := filepath.Join(dir, DefaultStateFile)
+	m := NewManager(DefaultSecretsFile)
+	if err := m.LoadState(statePath); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	m.AddFile(&File{ID: "1", Path: done, Size: 10, Downloaded: true, Encoded: true, EncodedPath: done + ".mp4", Uploaded: true, Moved: true})
+	m.AddFile(&File{ID: "2", Path: partial, Size: 10, Downloaded: true})
+	m.AddFile(&File{ID: "3", Path: encoded, Size: 10, Downloaded: true, Encoded: true, EncodedPath: encoded + ".mp4"})
+	m.AddFile(&File{ID: "4", Path: truncated, Size: 10, Downloaded: true, Encoded: true, EncodedPath: truncated + ".mp4", Uploaded: true})
+
+	m = NewManager(DefaultSecretsFile)
+	if err := m.LoadState(statePath); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if m.NumFiles() != 4 {
+		t.Fatalf("want: 4 files restored, out: %d", m.NumFiles())
+	}
+	pending, err := m.Resume()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(pending) != 3 {
+		t.Fatalf("want: 3 pending files, out: %d", len(pending))
+	}
+	if f := m.GetFile("2"); f.Downloaded {
+		t.Fatalf("want: partial download redone, out: %+v", f)
+	}
+	if f := m.GetFile("3"); !f.Downloaded || !f.Encoded {
+		t.Fatalf("want: encoded file kept, out: %+v", f)
+	}
+	if f := m.GetFile("4"); !f.Downloaded || f.Encoded || f.Uploaded {
+		t.Fatalf("want: truncated file encoded again, out: %+v", f)
+	}
+}
@@ -0,0 +1,208 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Types of Storage given in the storage section of the config.
+const (
+	StorageDrive = "drive"
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// Object is a file in Storage.
+type Object struct {
+	// ID identifies the object in Storage. It is the file ID on Google Drive,
+	// the path on local storage and the key on S3.
+	ID   string
+	Name string
+	Size int64
+	// Checksums are the ones computed by Storage, or recorded by the
+	// uploader if Storage doesn't compute.
+	Checksums
+	// URL is the location of the object shown to users.
+	URL string
+}
+
+// Storage is the place where sender puts the original files and receiver
+// puts the encoded files. Folders are the folder IDs on Google Drive, the
+// directories on local storage and the key prefixes on S3.
+type Storage interface {
+	// List returns the objects in folder.
+	List(ctx context.Context, folder string) ([]*Object, error)
+	// Stat returns the object with id.
+	Stat(ctx context.Context, id string) (*Object, error)
+	// Open returns the content of the object with id from the offset off.
+	Open(ctx context.Context, id string, off int64) (io.ReadCloser, error)
+	// Upload sends the local file at path into folder, and records sums to
+	// be verified by the downloader. It continues the upload session if
+	// given, and calls save with the new session when it starts one so that
+	// the upload can be resumed after failures.
+	Upload(ctx context.Context, path, folder, session string, save func(string) error, sums Checksums) (*Object, error)
+	// Move transfers the object with id from folder from to folder to.
+	Move(ctx context.Context, id, from, to string) error
+	// Delete removes the object with id.
+	Delete(ctx context.Context, id string) error
+}
+
+// StorageConfig is the storage section of the config.
+type StorageConfig struct {
+	// Type is one of StorageDrive (default), StorageLocal and StorageS3.
+	Type string `yaml:"type"`
+
+	// Endpoint, Region and Bucket are the S3 compatible service to use.
+	// Endpoint is such as "https://s3.ap-northeast-1.amazonaws.com" or
+	// "http://nas.local:9000", and objects are accessed in path style.
+	Endpoint string `yaml:"endpoint"`
+	Region   string `yaml:"region"`
+	Bucket   string `yaml:"bucket"`
+	// AccessKey and SecretKey default to AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY environment variables.
+	AccessKey string `yaml:"access_key"`
+	SecretKey string `yaml:"secret_key"`
+}
+
+func (c *StorageConfig) validate() error {
+	switch c.Type {
+	case "", StorageDrive, StorageLocal:
+	case StorageS3:
+		if c.Endpoint == "" || c.Bucket == "" {
+			return fmt.Errorf("storage: endpoint and bucket are required for s3")
+		}
+	default:
+		return fmt.Errorf("storage: unknown type %v", c.Type)
+	}
+	return nil
+}
+
+// localStorage is Storage on the local filesystem, including NFS mounted
+// directories.
+type localStorage struct{}
+
+func localObject(path string, fi os.FileInfo) *Object {
+	return &Object{
+		ID:   path,
+		Name: fi.Name(),
+		Size: fi.Size(),
+		URL:  path,
+	}
+}
+
+func (localStorage) List(ctx context.Context, folder string) ([]*Object, error) {
+	fis, err := ioutil.ReadDir(folder)
+	if err != nil {
+		return nil, err
+	}
+	objs := []*Object{}
+	for _, fi := range fis {
+		// files being uploaded are not listed.
+		if !fi.Mode().IsRegular() || strings.HasSuffix(fi.Name(), ".part") {
+			continue
+		}
+		objs = append(objs, localObject(filepath.Join(folder, fi.Name()), fi))
+	}
+	return objs, nil
+}
+
+// Stat computes MD5 of the file since the filesystem doesn't record it.
+func (localStorage) Stat(ctx context.Context, id string) (*Object, error) {
+	fi, err := os.Stat(id)
+	if err != nil {
+		return nil, err
+	}
+	o := localObject(id, fi)
+	sums, err := fileChecksums(id)
+	if err != nil {
+		return nil, err
+	}
+	o.MD5 = sums.MD5
+	return o, nil
+}
+
+func (localStorage) Open(ctx context.Context, id string, off int64) (io.ReadCloser, error) {
+	f, err := os.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := f.Seek(off, io.SeekStart); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Upload copies the file into folder with .part suffix, and renames it after
+// completed. The partial file left by the failure is continued. The
+// checksums are not recorded, and the copy is checked with its MD5 instead.
+func (s localStorage) Upload(ctx context.Context, path, folder, session string, save func(string) error, sums Checksums) (*Object, error) {
+	src, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	dst := filepath.Join(folder, filepath.Base(path))
+	part, err := os.OpenFile(dst+".part", os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	defer part.Close()
+	off, err := part.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := src.Seek(off, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, &contextReader{ctx, src}); err != nil {
+		return nil, err
+	}
+	if err := part.Close(); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(dst+".part", dst); err != nil {
+		return nil, err
+	}
+	return s.Stat(ctx, dst)
+}
+
+func (localStorage) Move(ctx context.Context, id, from, to string) error {
+	return os.Rename(id, filepath.Join(to, filepath.Base(id)))
+}
+
+func (localStorage) Delete(ctx context.Context, id string) error {
+	return os.Remove(id)
+}
+
+// contextReader is io.Reader which fails once ctx is canceled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
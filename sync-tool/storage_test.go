@@ -0,0 +1,81 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_localStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, d := range []string{"rec", "inbox", "done", "work"} {
+		os.Mkdir(filepath.Join(dir, d), 0755)
+	}
+	content := testContent(5000)
+	src := filepath.Join(dir, "rec", "a.ts")
+	ioutil.WriteFile(src, content, 0644)
+	// left by the upload failed in the middle.
+	ioutil.WriteFile(filepath.Join(dir, "inbox", "a.ts.part"), content[:2000], 0644)
+
+	inbox, done := filepath.Join(dir, "inbox"), filepath.Join(dir, "done")
+	c := &Config{
+		Storage:   StorageConfig{Type: StorageLocal},
+		Pipelines: []*Pipeline{{Name: DefaultPipeline, Inbox: inbox, Done: done, Output: done}},
+	}
+	m := NewManager("")
+	m.SetConfig(c)
+	if err := m.Init(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := m.Upload(context.Background(), src, inbox); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	files, err := m.FindNewFiles()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(files) != 1 || files[0].ID != filepath.Join(inbox, "a.ts") {
+		t.Fatalf("want: [%s], out: %v", filepath.Join(inbox, "a.ts"), files)
+	}
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(filepath.Join(dir, "work"))
+	_, path, err := m.Download(context.Background(), files[0].ID)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if b, _ := ioutil.ReadFile(path); !bytes.Equal(b, content) {
+		t.Fatalf("want: %d bytes, out: %d bytes", len(content), len(b))
+	}
+	if err := m.Move(files[0].ID); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := os.Stat(filepath.Join(done, "a.ts")); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if files, _ := m.FindNewFiles(); len(files) != 0 {
+		t.Fatalf("want: [], out: %v", files)
+	}
+}
@@ -0,0 +1,118 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	// DefaultChunkSize is the size of each request of resumable uploads.
+	DefaultChunkSize = 8 << 20
+
+	// chunkAlign is the unit of the chunk size required by Drive.
+	chunkAlign = 256 << 10
+
+	// maxTransferRetries is the number of consecutive failures of upload
+	// chunks or downloads to give up the transfer in a call.
+	maxTransferRetries = 3
+)
+
+// transferRetryPolicy is the backoff between the retries of upload chunks
+// or downloads in a call.
+var transferRetryPolicy = RetryPolicy{
+	MaxAttempts: maxTransferRetries + 1,
+	Backoff:     1 * time.Second,
+	MaxBackoff:  10 * time.Second,
+}
+
+// backoff waits for the delay of transferRetryPolicy after attempts
+// failures, or until ctx is canceled.
+func backoff(ctx context.Context, attempts int) error {
+	t := time.NewTimer(transferRetryPolicy.Delay(attempts))
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetChunkSize sets the chunk size of uploads. It is rounded up to the
+// multiple of 256KiB as Drive requires. It must be called before Init.
+func (m *Manager) SetChunkSize(n int64) {
+	if n < chunkAlign {
+		n = chunkAlign
+	}
+	m.chunkSize = (n + chunkAlign - 1) / chunkAlign * chunkAlign
+}
+
+// responseError returns the error with the status and the body of res.
+func responseError(op string, res *http.Response) error {
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	return fmt.Errorf("%s: %s: %s", op, res.Status, bytes.TrimSpace(b))
+}
+
+// fetch downloads the object with id into part. It continues from the end
+// of part if part already exists, and returns the size of part.
+func (m *Manager) fetch(ctx context.Context, id, part string, size int64) (int64, error) {
+	file, err := os.OpenFile(part, os.O_WRONLY|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+	off, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if size > 0 && off > size {
+		if off, err = restart(file); err != nil {
+			return 0, err
+		}
+	}
+	if size > 0 && off == size {
+		return off, nil
+	}
+	r, err := m.storage.Open(ctx, id, off)
+	if err != nil {
+		return off, err
+	}
+	defer r.Close()
+	n, err := io.Copy(file, r)
+	off += n
+	if err != nil {
+		return off, err
+	}
+	if size > 0 && off != size {
+		return off, fmt.Errorf("download: %v is truncated: %d of %d bytes", part, off, size)
+	}
+	return off, file.Close()
+}
+
+// restart truncates file to download from the beginning.
+func restart(file *os.File) (int64, error) {
+	if err := file.Truncate(0); err != nil {
+		return 0, err
+	}
+	return file.Seek(0, io.SeekStart)
+}
@@ -0,0 +1,332 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeDrive is the Drive API server which breaks the transfers on purpose.
+type fakeDrive struct {
+	url string
+
+	mu      sync.Mutex
+	name    string
+	content []byte
+	md5     string
+	// appProperties are recorded by the uploader.
+	appProperties map[string]string
+	// corrupt breaks the uploaded content.
+	corrupt bool
+	// breakDownloads and breakChunks are the number of the transfers to
+	// break in the middle.
+	breakDownloads int
+	breakChunks    int
+	ranges         []string
+	sessions       int
+	// puts is the number of the upload requests, and incomplete makes the
+	// uploads never finish.
+	puts       int
+	incomplete bool
+	received   []byte
+	deleted    []string
+}
+
+func newFakeDrive(name string, content []byte) *fakeDrive {
+	sum := md5.Sum(content)
+	sha := sha256.Sum256(content)
+	return &fakeDrive{
+		name:          name,
+		content:       content,
+		md5:           hex.EncodeToString(sum[:]),
+		appProperties: map[string]string{"sha256": hex.EncodeToString(sha[:])},
+	}
+}
+
+func (d *fakeDrive) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	switch {
+	case r.Method == "GET" && strings.HasPrefix(r.URL.Path, "/drive/v3/files/"):
+		if r.URL.Query().Get("alt") != "media" {
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"id":            strings.TrimPrefix(r.URL.Path, "/drive/v3/files/"),
+				"name":          d.name,
+				"size":          strconv.Itoa(len(d.content)),
+				"md5Checksum":   d.md5,
+				"appProperties": d.appProperties,
+			})
+			return
+		}
+		body := d.content
+		status := http.StatusOK
+		if rg := r.Header.Get("Range"); rg != "" {
+			d.ranges = append(d.ranges, rg)
+			off, _ := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(rg, "bytes="), "-"))
+			body = body[off:]
+			status = http.StatusPartialContent
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.WriteHeader(status)
+		if d.breakDownloads > 0 {
+			d.breakDownloads--
+			w.Write(body[:len(body)/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		w.Write(body)
+	case r.Method == "DELETE" && strings.HasPrefix(r.URL.Path, "/drive/v3/files/"):
+		d.deleted = append(d.deleted, strings.TrimPrefix(r.URL.Path, "/drive/v3/files/"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == "POST" && r.URL.Path == "/upload/drive/v3/files":
+		d.sessions++
+		d.received = nil
+		var meta struct {
+			AppProperties map[string]string `json:"appProperties"`
+		}
+		json.NewDecoder(r.Body).Decode(&meta)
+		d.appProperties = meta.AppProperties
+		w.Header().Set("Location", fmt.Sprintf("%s/upload/session/%d", d.url, d.sessions))
+	case r.Method == "PUT" && r.URL.Path == fmt.Sprintf("/upload/session/%d", d.sessions):
+		d.puts++
+		cr := r.Header.Get("Content-Range")
+		total, _ := strconv.Atoi(cr[strings.Index(cr, "/")+1:])
+		if !strings.HasPrefix(cr, "bytes */") {
+			if d.breakChunks > 0 {
+				d.breakChunks--
+				io.CopyN(ioutil.Discard, r.Body, r.ContentLength/2)
+				panic(http.ErrAbortHandler)
+			}
+			b, _ := ioutil.ReadAll(r.Body)
+			if d.corrupt {
+				b[0]++
+			}
+			d.received = append(d.received, b...)
+		}
+		if len(d.received) == total && !d.incomplete {
+			w.WriteHeader(http.StatusCreated)
+			sum := md5.Sum(d.received)
+			json.NewEncoder(w).Encode(map[string]string{"id": "uploaded", "md5Checksum": hex.EncodeToString(sum[:])})
+			return
+		}
+		if len(d.received) > 0 {
+			w.Header().Set("Range", fmt.Sprintf("bytes=0-%d", len(d.received)-1))
+		}
+		w.WriteHeader(http.StatusPermanentRedirect)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func newTestManager(t *testing.T, d *fakeDrive) (*Manager, func()) {
+	srv := httptest.NewServer(d)
+	d.url = srv.URL
+	s, err := newDriveStorage(srv.Client(), 1024)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	s.service.BasePath = srv.URL + "/drive/v3/"
+	s.uploadURL = srv.URL + "/upload/drive/v3/files"
+	m := NewManager("")
+	m.storage = s
+	return m, srv.Close
+}
+
+// fastRetry shortens the backoff between the retries of transfers, and
+// returns the function to restore it.
+func fastRetry() func() {
+	p := transferRetryPolicy
+	transferRetryPolicy.Backoff, transferRetryPolicy.MaxBackoff = time.Millisecond, time.Millisecond
+	return func() { transferRetryPolicy = p }
+}
+
+func testContent(n int) []byte {
+	b := make([]byte, n)
+	rand.New(rand.NewSource(1)).Read(b)
+	return b
+}
+
+func Test_Download(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer fastRetry()()
+	cwd, _ := os.Getwd()
+	defer os.Chdir(cwd)
+	os.Chdir(dir)
+
+	content := testContent(10000)
+	d := newFakeDrive("a.ts", content)
+	m, stop := newTestManager(t, d)
+	defer stop()
+
+	// broken more times than retried in a call, and resumed by next call.
+	d.breakDownloads = maxTransferRetries + 2
+	if _, _, err := m.Download(context.Background(), "a"); err == nil {
+		t.Fatalf("want: error, out: nil")
+	}
+	n, path, err := m.Download(context.Background(), "a")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	want := []string{"bytes=5000-", "bytes=7500-", "bytes=8750-", "bytes=9375-", "bytes=9687-"}
+	if strings.Join(d.ranges, ",") != strings.Join(want, ",") {
+		t.Fatalf("want: %v, out: %v", want, d.ranges)
+	}
+	b, _ := ioutil.ReadFile(path)
+	if n != int64(len(content)) || !bytes.Equal(b, content) || filepath.Base(path) != "a.ts" {
+		t.Fatalf("want: %d bytes, out: %d bytes in %s", len(content), n, path)
+	}
+	if f := m.GetFile("a"); f == nil || !f.Downloaded {
+		t.Fatalf("want: downloaded, out: %v", f)
+	}
+
+	// the content differs from the one sender recorded.
+	d.appProperties["sha256"] = strings.Repeat("0", 64)
+	if _, _, err := m.Download(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "sha256 mismatch") {
+		t.Fatalf("want: sha256 error, out: %v", err)
+	}
+	if _, err := os.Stat("a.ts.part"); !os.IsNotExist(err) {
+		t.Fatalf("want: part removed, out: %v", err)
+	}
+
+	// the content can't be verified without checksums.
+	d.md5, d.appProperties = "", nil
+	if _, _, err := m.Download(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "no checksum") {
+		t.Fatalf("want: no checksum error, out: %v", err)
+	}
+}
+
+func Test_upload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer fastRetry()()
+	content := testContent(2500)
+	path := filepath.Join(dir, "a.ts.mp4")
+	ioutil.WriteFile(path, content, 0644)
+
+	d := newFakeDrive("a.ts.mp4", nil)
+	m, stop := newTestManager(t, d)
+	defer stop()
+
+	session := ""
+	save := func(s string) error {
+		session = s
+		return nil
+	}
+	d.breakChunks = 1
+	res, err := m.upload(context.Background(), path, "out", session, save)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if res.ID != "uploaded" || !bytes.Equal(d.received, content) || d.sessions != 1 {
+		t.Fatalf("want: %d bytes in 1 session, out: %d bytes in %d sessions", len(content), len(d.received), d.sessions)
+	}
+
+	// broken more times than retried in a call, and resumed with the saved
+	// session by next call.
+	session = ""
+	d.breakChunks = maxTransferRetries + 1
+	if _, err := m.upload(context.Background(), path, "out", session, save); err == nil {
+		t.Fatalf("want: error, out: nil")
+	}
+	if session == "" {
+		t.Fatalf("want: session saved, out: empty")
+	}
+	if _, err := m.upload(context.Background(), path, "out", session, save); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !bytes.Equal(d.received, content) || d.sessions != 2 {
+		t.Fatalf("want: %d bytes in 2 sessions, out: %d bytes in %d sessions", len(content), len(d.received), d.sessions)
+	}
+	sha := sha256.Sum256(content)
+	if want := hex.EncodeToString(sha[:]); d.appProperties["sha256"] != want {
+		t.Fatalf("want: %s, out: %s", want, d.appProperties["sha256"])
+	}
+
+	// the encoded file broken on the way fails the job, and is uploaded
+	// again in a new session.
+	f := NewFile(filepath.Join(dir, "a.ts"), "a")
+	f.Downloaded, f.Encoded, f.EncodedPath = true, true, path
+	m.AddFile(f)
+	d.corrupt = true
+	if _, err := m.UploadEncoded(context.Background(), "a"); err == nil || !strings.Contains(err.Error(), "md5 mismatch") {
+		t.Fatalf("want: md5 error, out: %v", err)
+	}
+	if f.Uploaded || f.UploadSession != "" {
+		t.Fatalf("want: not uploaded without session, out: %v", f)
+	}
+	if len(d.deleted) != 1 || d.deleted[0] != "uploaded" {
+		t.Fatalf("want: [uploaded] deleted, out: %v", d.deleted)
+	}
+	d.corrupt = false
+	if _, err := m.UploadEncoded(context.Background(), "a"); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if !f.Uploaded || d.sessions != 4 {
+		t.Fatalf("want: uploaded in 4 sessions, out: %v in %d sessions", f, d.sessions)
+	}
+}
+
+func Test_uploadEmpty(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	defer fastRetry()()
+	path := filepath.Join(dir, "empty.ts")
+	ioutil.WriteFile(path, nil, 0644)
+
+	d := newFakeDrive("empty.ts", nil)
+	m, stop := newTestManager(t, d)
+	defer stop()
+
+	if _, err := m.upload(context.Background(), path, "out", "", nil); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if d.sessions != 1 || d.puts != 1 {
+		t.Fatalf("want: 1 request in 1 session, out: %d requests in %d sessions", d.puts, d.sessions)
+	}
+
+	// the session never finished is an error instead of polling forever.
+	d.incomplete = true
+	if _, err := m.upload(context.Background(), path, "out", "", nil); err == nil {
+		t.Fatalf("want: error, out: nil")
+	}
+}
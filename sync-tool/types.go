@@ -19,10 +19,11 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
-	"mime"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strings"
+	"sync"
 
 	"golang.org/x/oauth2/google"
 
@@ -47,21 +48,44 @@ const (
 	GoogleDriveOpenURL = "https://drive.google.com/open?id=%s"
 )
 
-// Manager is the wrapper of Google Drive files service.
+// Manager manages the files processed through Storage. It is safe for
+// concurrent use as long as each File is processed by one goroutine at a time.
 type Manager struct {
-	secrets string
-	service *drive.Service
-	files   []*File
+	secrets   string
+	storage   Storage
+	chunkSize int64
+	statePath string
+	config    *Config
+	// keep is true if SenderPerge leaves the original files to be removed by
+	// others.
+	keep bool
+
+	// mu protects files and the fields of them.
+	mu    sync.Mutex
+	files []*File
 }
 
 // File holds required info for encoding management.
 type File struct {
-	Path        string
-	ID          string
-	Downloaded  bool
-	Encoded     bool
-	EncodedPath string
-	Uploaded    bool
+	Path        string `json:"path"`
+	ID          string `json:"id"`
+	Pipeline    string `json:"pipeline,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Downloaded  bool   `json:"downloaded"`
+	Encoded     bool   `json:"encoded"`
+	EncodedPath string `json:"encoded_path,omitempty"`
+	Uploaded    bool   `json:"uploaded"`
+	// UploadSession is the URI of the resumable upload session in progress,
+	// of the original file on sender and of the encoded file on receiver.
+	UploadSession string `json:"upload_session,omitempty"`
+	// Moved is true if the original file is moved into the encode done folder.
+	Moved bool `json:"moved"`
+	// Stage, Attempts and LastError record the failures of the current stage.
+	Stage     string `json:"stage,omitempty"`
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	// Dead is true if the file is given up after failing too many times.
+	Dead bool `json:"dead,omitempty"`
 }
 
 func NewFile(path, id string) *File {
@@ -75,17 +99,69 @@ func NewFile(path, id string) *File {
 	}
 }
 
-// NewManager creates Manager with OAuth2 client secrets. It must call Init() method to activate actual drive.Service.
+// NewManager creates Manager with OAuth2 client secrets. It must call Init() method to activate actual Storage.
 func NewManager(secrets string) *Manager {
 	return &Manager{
-		secrets: secrets,
-		service: nil,
+		secrets:   secrets,
+		storage:   nil,
+		chunkSize: DefaultChunkSize,
+		config:    DefaultConfig(),
+	}
+}
+
+// update calls fn with the lock of files held, and saves the state.
+func (m *Manager) update(fn func()) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fn()
+	return m.save()
+}
+
+// SetConfig replaces the pipelines of m with the ones in c.
+func (m *Manager) SetConfig(c *Config) {
+	m.config = c
+}
+
+// SetKeepOriginals makes SenderPerge keep the original files instead of
+// removing them. They are forgotten once they are removed by others, such as
+// trash with -sync-state.
+func (m *Manager) SetKeepOriginals(keep bool) {
+	m.keep = keep
+}
+
+// RetryPolicy returns the retry policy of stage in the config.
+func (m *Manager) RetryPolicy(stage string) RetryPolicy {
+	return m.config.RetryPolicy(stage)
+}
+
+// pipeline returns the pipeline which f belongs to. Files without pipeline
+// belong to the first one.
+func (m *Manager) pipeline(f *File) (*Pipeline, error) {
+	if f.Pipeline == "" {
+		return m.config.Pipelines[0], nil
+	}
+	p := m.config.Pipeline(f.Pipeline)
+	if p == nil {
+		return nil, fmt.Errorf("unknown pipeline %v for %v", f.Pipeline, f.Path)
 	}
+	return p, nil
 }
 
-// Init creates http.Client based on oauth2.Config and holds drive.Service
-// with hte credential.
+// Init creates Storage given in the config. For Google Drive, it creates
+// http.Client based on oauth2.Config with the credential.
 func (m *Manager) Init() error {
+	switch c := m.config.Storage; c.Type {
+	case StorageLocal:
+		m.storage = localStorage{}
+		return nil
+	case StorageS3:
+		s, err := newS3Storage(c, m.chunkSize)
+		if err != nil {
+			return err
+		}
+		m.storage = s
+		return nil
+	}
 	ctx := context.Background()
 	b, err := ioutil.ReadFile(m.secrets)
 	if err != nil {
@@ -99,94 +175,199 @@ func (m *Manager) Init() error {
 	if err != nil {
 		return err
 	}
-	service, err := drive.New(client)
+	s, err := newDriveStorage(client, m.chunkSize)
 	if err != nil {
 		return err
 	}
-	m.service = service
+	m.storage = s
 	return nil
 }
 
-// FindFiles get files in UploadTargetfolderid.
-func (m *Manager) FindFiles() ([]drive.File, error) {
-	files := []drive.File{}
-	// see parameter setting on https://developers.google.com/drive/v3/web/search-parameters#fn4
-	query := fmt.Sprintf("'%s' in parents", UploadTargetFolderID)
-	fl, err := m.service.Files.List().Q(query).Do()
+// FindFiles get files in the inbox folder of the pipeline.
+func (m *Manager) FindFiles(p *Pipeline) ([]*Object, error) {
+	files, err := m.storage.List(context.Background(), p.Inbox)
 	if err != nil {
 		return nil, fmt.Errorf("FindFiles: %v", err)
 	}
-	for _, f := range fl.Files {
-		files = append(files, *f)
-	}
 	return files, nil
 }
 
-// FindNewFiles checks new files uploaded on Google Drive and returns those.
+// FindNewFiles checks new files uploaded on Storage and returns those.
 func (m *Manager) FindNewFiles() ([]*File, error) {
-	files, err := m.FindFiles()
-	if err != nil {
-		return nil, fmt.Errorf("FindNewFiles: %v", err)
+	found := map[*Pipeline][]*Object{}
+	for _, p := range m.config.Pipelines {
+		files, err := m.FindFiles(p)
+		if err != nil {
+			return nil, fmt.Errorf("FindNewFiles: %v", err)
+		}
+		found[p] = files
 	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	newFiles := []*File{}
-loop:
-	for _, f := range files {
-		for _, mf := range m.files {
-			if mf == nil {
-				continue
-			}
-			if f.Id == mf.ID {
-				continue loop
+	for _, p := range m.config.Pipelines {
+	loop:
+		for _, f := range found[p] {
+			for _, mf := range m.files {
+				if mf == nil {
+					continue
+				}
+				if f.ID == mf.ID {
+					continue loop
+				}
 			}
+			nf := NewFile(f.Name, f.ID)
+			nf.Size = f.Size
+			nf.Pipeline = p.Name
+			newFiles = append(newFiles, nf)
 		}
-		nf := NewFile(f.Name, f.Id)
-		newFiles = append(newFiles, nf)
 	}
 	m.files = append(m.files, newFiles...)
+	if len(newFiles) > 0 {
+		if err := m.save(); err != nil {
+			return nil, fmt.Errorf("FindNewFiles: %v", err)
+		}
+	}
 	return newFiles, nil
 }
 
-// Upload sends a file in path to directory id in Google Drive with the description.
-func (m *Manager) Upload(path, desc string, parents []string) (*drive.File, error) {
-	f, err := os.Open(path)
+// Upload sends a file in path to folder in Storage with its checksums.
+func (m *Manager) Upload(ctx context.Context, path, folder string) (*Object, error) {
+	return m.upload(ctx, path, folder, "", nil)
+}
+
+// upload sends a file in path to folder in Storage with its checksums, and
+// compares them with the ones computed by Storage after uploaded. The
+// object broken on the way is deleted so that it is never consumed.
+func (m *Manager) upload(ctx context.Context, path, folder, session string, save func(string) error) (*Object, error) {
+	sums, err := fileChecksums(path)
 	if err != nil {
 		return nil, err
 	}
-	filename := filepath.Base(path)
-	mimeType := mime.TypeByExtension(filepath.Ext(filename))
-	dst := &drive.File{
-		Name:        filename,
-		Description: desc,
-		Parents:     parents,
-		MimeType:    mimeType,
-	}
-	res, err := m.service.Files.Create(dst).Media(f).Do()
+	o, err := m.storage.Upload(ctx, path, folder, session, save, sums)
 	if err != nil {
 		return nil, err
 	}
+	if err := sums.match(o.URL, o.Checksums); err != nil {
+		e := err.(*checksumError)
+		e.deleteErr = m.storage.Delete(ctx, o.ID)
+		return nil, e
+	}
+	return o, nil
+}
+
+// uploadFile sends the local file at path of f into folder, continuing the
+// upload session of f.
+func (m *Manager) uploadFile(ctx context.Context, f *File, path, folder string) (*Object, error) {
+	save := func(s string) error {
+		return m.update(func() { f.UploadSession = s })
+	}
+	res, err := m.upload(ctx, path, folder, f.UploadSession, save)
+	if _, ok := err.(*checksumError); ok {
+		// the session is completed with the broken content, and the upload
+		// has to start over.
+		if serr := save(""); serr != nil {
+			return nil, serr
+		}
+	}
+	return res, err
+}
 
-	return res, nil
+// SenderAdd registers the local file at path to be sent by SenderUpload into
+// the inbox folder of the pipeline which accepts it. It does nothing if the
+// file is already registered.
+func (m *Manager) SenderAdd(path string) error {
+	p := m.config.PipelineFor(path)
+	if p == nil {
+		return fmt.Errorf("SenderAdd: no pipeline accepts %v", path)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range m.files {
+		if f != nil && f.Path == path {
+			return nil
+		}
+	}
+	f := NewFile(path, "")
+	f.Pipeline = p.Name
+	m.files = append(m.files, f)
+	return m.save()
 }
 
-func (m *Manager) SenderUpload() {
+// SenderUpload sends the files registered by SenderAdd and not uploaded yet.
+// The lock is not held while uploading, so it must not be called
+// concurrently.
+func (m *Manager) SenderUpload(ctx context.Context) error {
+	m.mu.Lock()
+	pending := []*File{}
 	for _, f := range m.files {
-		if !f.Uploaded {
-			_, err := m.Upload(f.Path, "", []string{UploadTargetFolderID})
-			if err == nil {
+		if f != nil && !f.Uploaded {
+			pending = append(pending, f)
+		}
+	}
+	m.mu.Unlock()
+
+	errs := []string{}
+	for _, f := range pending {
+		p, err := m.pipeline(f)
+		if err != nil {
+			errs = append(errs, err.Error())
+			continue
+		}
+		res, err := m.uploadFile(ctx, f, f.Path, p.Inbox)
+		if err == nil {
+			err = m.update(func() {
+				f.ID = res.ID
 				f.Uploaded = true
-			}
+				f.UploadSession = ""
+			})
 		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", f.Path, err))
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("SenderUpload: %v", strings.Join(errs, ", "))
 	}
+	return nil
 }
 
-func (m *Manager) AddFile(f *File) {
-	m.files = append(m.files, f)
+// AddFile adds f to files field and saves the state.
+func (m *Manager) AddFile(f *File) error {
+	return m.update(func() { m.files = append(m.files, f) })
+}
+
+// UploadEncoded sends the encoded file of the file with id to the output
+// folder of its pipeline.
+func (m *Manager) UploadEncoded(ctx context.Context, id string) (*Object, error) {
+	mf := m.GetFile(id)
+	if mf == nil {
+		return nil, fmt.Errorf("UploadEncoded: unknown file %v", id)
+	}
+	p, err := m.pipeline(mf)
+	if err != nil {
+		return nil, err
+	}
+	res, err := m.uploadFile(ctx, mf, mf.EncodedPath, p.Output)
+	if err != nil {
+		return nil, err
+	}
+	return res, m.update(func() {
+		mf.Uploaded = true
+		mf.UploadSession = ""
+	})
 }
 
 // Download fetches and creates a file from the path to current directory.
-func (m *Manager) Download(id string) (int64, string, error) {
-	//ctx, cancel := context.WithCancel(context.TODO())
-	f, err := m.service.Files.Get(id).Fields("id", "name").Do()
+// It is aborted when ctx is canceled. The partial file left by the failure
+// is continued on the next call, and the file is verified with the
+// checksums recorded by sender or computed by Storage after completed.
+func (m *Manager) Download(ctx context.Context, id string) (int64, string, error) {
+	f, err := m.storage.Stat(ctx, id)
 	if err != nil {
 		return 0, "", err
 	}
@@ -195,66 +376,98 @@ func (m *Manager) Download(id string) (int64, string, error) {
 		return 0, "", err
 	}
 	path := filepath.Join(cwd, f.Name)
-	file, err := os.Create(path)
-	if err != nil {
-		return 0, "", err
+	// the file is written with .part suffix until completed so that partial
+	// downloads are never regarded as downloaded.
+	part := path + ".part"
+	var n int64
+	for i := 0; ; i++ {
+		n, err = m.fetch(ctx, id, part, f.Size)
+		if err == nil {
+			break
+		}
+		if ctx.Err() != nil || i >= maxTransferRetries {
+			return n, "", err
+		}
+		if err := backoff(ctx, i+1); err != nil {
+			return n, "", err
+		}
 	}
-	defer file.Close()
-	res, err := m.service.Files.Get(id).Download()
+	// the file without checksums is never regarded as downloaded since it
+	// can't be verified.
+	if f.MD5 == "" && f.SHA256 == "" {
+		return n, "", fmt.Errorf("Download: no checksum is recorded for %v", f.URL)
+	}
+	sums, err := fileChecksums(part)
 	if err != nil {
-		return 0, "", err
+		return n, "", err
 	}
-	defer res.Body.Close()
-
-	n, err := io.Copy(file, res.Body)
-	mf := m.GetFile(f.Id)
-	if mf == nil {
-		mf = &File{
-			ID:          f.Id,
-			Path:        path,
-			Downloaded:  true,
-			Encoded:     false,
-			EncodedPath: "",
-			Uploaded:    false,
-		}
-		m.files = append(m.files, mf)
+	if err := f.match(part, sums); err != nil {
+		os.Remove(part)
+		return n, "", fmt.Errorf("Download: %v", err)
 	}
-	mf.Downloaded = true
-	return n, path, nil
+	if err := os.Rename(part, path); err != nil {
+		return n, "", err
+	}
+	return n, path, m.update(func() {
+		mf := m.getFile(f.ID)
+		if mf == nil {
+			mf = &File{
+				ID:          f.ID,
+				Path:        path,
+				Downloaded:  true,
+				Encoded:     false,
+				EncodedPath: "",
+				Uploaded:    false,
+			}
+			m.files = append(m.files, mf)
+		}
+		mf.Path = path
+		mf.Size = f.Size
+		mf.Downloaded = true
+	})
 }
 
-// Move transfers a file from upload target folder to encode done folder.
+// Move transfers a file from the inbox folder to the encode done folder of
+// its pipeline.
 func (m *Manager) Move(id string) error {
-	_, err := m.service.Files.Update(id, nil).AddParents(EncodeDoneFolderID).RemoveParents(UploadTargetFolderID).Do()
+	mf := m.GetFile(id)
+	if mf == nil {
+		return fmt.Errorf("Move: unknown file %v", id)
+	}
+	p, err := m.pipeline(mf)
 	if err != nil {
 		return err
 	}
-	return nil
+	err = m.storage.Move(context.Background(), id, p.Inbox, p.Done)
+	if err != nil {
+		return err
+	}
+	return m.update(func() { mf.Moved = true })
 }
 
-// Encode start encoding using ffmpeg.
-func (m *Manager) Encode(id string) error {
+// Encode start encoding using ffmpeg. ffmpeg is killed when ctx is canceled.
+func (m *Manager) Encode(ctx context.Context, id string) error {
 	mf := m.GetFile(id)
-	args := []string{
-		"-i", fmt.Sprintf("%s", mf.Path),
-		"-crf", "20.0",
-		"-vcodec", "libx264", "-vf", "scale=1920:1080",
-		"-preset", "slow",
-		"-acodec", "aac", "-strict", "experimental",
-		"-ar", "48000", "-b:a", "192k",
-		"-coder", "1",
-		"-flags", "+loop",
-		"-cmp", "chroma", "-partitions", "+parti4x4+partp8x8+partb8x8",
-		"-me_method", "hex", "-subq", "6", "-me_range", "16", "-g", "60",
-		"-keyint_min", "25",
-		"-sc_threshold", "35",
-		"-i_qfactor", "0.71",
-		"-b_strategy", "1",
-		"-threads", "0",
-		"-f", "mp4",
-		fmt.Sprintf("%s.mp4", mf.Path),
-	}
-	cmd := exec.Command("ffmpeg", args...)
+	if mf == nil {
+		return fmt.Errorf("Encode: unknown file %v", id)
+	}
+	p, err := m.pipeline(mf)
+	if err != nil {
+		return err
+	}
+	prof, err := m.config.ProfileFor(p, mf.Path)
+	if err != nil {
+		return err
+	}
+	if err := prof.Validate(); err != nil {
+		return err
+	}
+	out := prof.Output(mf.Path)
+	if err := m.update(func() { mf.EncodedPath = out }); err != nil {
+		return err
+	}
+	args := append([]string{"-y"}, prof.Command(mf.Path, out)...)
+	cmd := exec.CommandContext(ctx, "ffmpeg", args...)
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
 		return err
@@ -269,21 +482,22 @@ func (m *Manager) Encode(id string) error {
 	if err != nil {
 		return err
 	}
-	mf.Encoded = true
-	return nil
+	return m.update(func() { mf.Encoded = true })
 }
 
 // Perge removes all processed file instance from files field and delete all processed files from file system.
 func (m *Manager) Perge() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	left := []*File{}
 	for _, f := range m.files {
-		if f.Downloaded && f.Encoded {
+		if f.Downloaded && f.Encoded && f.Uploaded && f.Moved {
 			err := os.Remove(f.Path)
-			if err != nil {
+			if err != nil && !os.IsNotExist(err) {
 				return err
 			}
-			err = os.Remove(f.Path + ".mp4")
-			if err != nil {
+			err = os.Remove(f.EncodedPath)
+			if err != nil && !os.IsNotExist(err) {
 				return err
 			}
 			continue
@@ -291,44 +505,88 @@ func (m *Manager) Perge() error {
 		left = append(left, f)
 	}
 	m.files = left
-	return nil
+	return m.save()
 }
 
-// SenderPerge checks if the file is uploaded and in encode done folder.
-// If both are satisfiled, removes the original ts file.
+// SenderPerge marks the files which are uploaded and found in the encode done
+// folder as encoded, and removes and forgets them. The files already removed
+// are just forgotten. With SetKeepOriginals, the files are kept and
+// remembered as encoded until they are removed by others.
 func (m *Manager) SenderPerge() error {
-	query := fmt.Sprintf("'%s' in parents", EncodeDoneFolderID)
-	fl, err := m.service.Files.List().Q(query).Do()
-	if err != nil {
-		return err
+	done := []*Object{}
+	for _, p := range m.config.Pipelines {
+		objs, err := m.storage.List(context.Background(), p.Done)
+		if err != nil {
+			return err
+		}
+		done = append(done, objs...)
 	}
 
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	left := []*File{}
-	// TODO: find better expression here.
+	errs := []string{}
 	for _, mf := range m.files {
-		if mf.Uploaded {
-			for _, f := range fl.Files {
-				if mf.ID == f.Id {
-					err := os.Remove(mf.Path)
-					if err != nil {
-						return err
-					}
+		if mf == nil {
+			continue
+		}
+		if mf.Uploaded && encodeDone(mf, done) {
+			mf.Encoded = true
+			var err error
+			if m.keep {
+				_, err = os.Stat(mf.Path)
+				if err == nil {
+					left = append(left, mf)
+					continue
 				}
+			} else {
+				err = os.Remove(mf.Path)
 			}
-			left = append(left, mf)
+			if err == nil || os.IsNotExist(err) {
+				continue
+			}
+			errs = append(errs, err.Error())
 		}
+		left = append(left, mf)
 	}
 	m.files = left
+	if err := m.save(); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("SenderPerge: %v", strings.Join(errs, ", "))
+	}
 	return nil
 }
 
+// encodeDone returns true if f is in done, the objects in the encode done
+// folders.
+func encodeDone(f *File, done []*Object) bool {
+	for _, o := range done {
+		// the ID changes on moving on local storage and S3.
+		if f.ID == o.ID || filepath.Base(f.Path) == o.Name {
+			return true
+		}
+	}
+	return false
+}
+
 // NumFiles returns number of instance in files field.
 func (m *Manager) NumFiles() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	return len(m.files)
 }
 
 // GetFile returns File instance with id from files field.
 func (m *Manager) GetFile(id string) *File {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.getFile(id)
+}
+
+// getFile is GetFile without the lock.
+func (m *Manager) getFile(id string) *File {
 	for _, f := range m.files {
 		if f != nil && f.ID == id {
 			return f
@@ -0,0 +1,188 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package synctool
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newSenderManager returns Manager on local storage with the pipelines
+// "anime" for the files with "アニメ" and "default" for the others.
+func newSenderManager(t *testing.T, dir string) *Manager {
+	for _, d := range []string{"rec", "anime", "inbox", "done"} {
+		os.Mkdir(filepath.Join(dir, d), 0755)
+	}
+	c, err := ParseConfig([]byte(`
+storage:
+  type: local
+pipelines:
+  - name: anime
+    match: アニメ
+    inbox: ` + filepath.Join(dir, "anime") + `
+    done: ` + filepath.Join(dir, "done") + `
+    output: ` + filepath.Join(dir, "done") + `
+  - name: default
+    inbox: ` + filepath.Join(dir, "inbox") + `
+    done: ` + filepath.Join(dir, "done") + `
+    output: ` + filepath.Join(dir, "done") + `
+`))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	m := NewManager("")
+	m.SetConfig(c)
+	if err := m.Init(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	return m
+}
+
+func Test_SenderUpload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	m := newSenderManager(t, dir)
+
+	for _, name := range []string{"アニメ_1.ts", "news.ts"} {
+		path := filepath.Join(dir, "rec", name)
+		ioutil.WriteFile(path, testContent(100), 0644)
+		if err := m.SenderAdd(path); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		// registered only once.
+		if err := m.SenderAdd(path); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	if err := m.SenderUpload(context.Background()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for _, path := range []string{"anime/アニメ_1.ts", "inbox/news.ts"} {
+		f := m.GetFile(filepath.Join(dir, path))
+		if f == nil || !f.Uploaded {
+			t.Fatalf("want: %s uploaded, out: %v", path, f)
+		}
+	}
+	if m.NumFiles() != 2 {
+		t.Fatalf("want: 2 files, out: %d", m.NumFiles())
+	}
+}
+
+func Test_SenderPerge(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	m := newSenderManager(t, dir)
+	statePath := filepath.Join(dir, DefaultStateFile)
+	if err := m.LoadState(statePath); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	paths := []string{}
+	for _, name := range []string{"a.ts", "b.ts", "c.ts"} {
+		path := filepath.Join(dir, "rec", name)
+		ioutil.WriteFile(path, testContent(100), 0644)
+		m.SenderAdd(path)
+		paths = append(paths, path)
+	}
+	if err := m.SenderUpload(context.Background()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	// a.ts and b.ts are encoded, and b.ts is already removed by hand.
+	for _, name := range []string{"a.ts", "b.ts"} {
+		if err := m.storage.Move(context.Background(), filepath.Join(dir, "inbox", name), "", filepath.Join(dir, "done")); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	os.Remove(paths[1])
+	d := filepath.Join(dir, "rec", "d.ts")
+	ioutil.WriteFile(d, testContent(100), 0644)
+	m.SenderAdd(d)
+
+	if err := m.SenderPerge(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := os.Stat(paths[0]); !os.IsNotExist(err) {
+		t.Fatalf("want: %s removed, out: %v", paths[0], err)
+	}
+	if _, err := os.Stat(paths[2]); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	// the perged files are forgotten across restarts, and the files not
+	// uploaded yet are kept.
+	m = newSenderManager(t, dir)
+	if err := m.LoadState(statePath); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := m.SenderPerge(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if m.NumFiles() != 2 || m.GetFile(filepath.Join(dir, "inbox", "c.ts")) == nil {
+		t.Fatalf("want: c.ts and d.ts, out: %d files", m.NumFiles())
+	}
+}
+
+func Test_SenderPergeKeep(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sync-tool")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	m := newSenderManager(t, dir)
+	m.SetKeepOriginals(true)
+
+	path := filepath.Join(dir, "rec", "a.ts")
+	ioutil.WriteFile(path, testContent(100), 0644)
+	m.SenderAdd(path)
+	if err := m.SenderUpload(context.Background()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if err := m.SenderPerge(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if f := m.GetFile(filepath.Join(dir, "inbox", "a.ts")); f == nil || f.Encoded {
+		t.Fatalf("want: a.ts not encoded yet, out: %v", f)
+	}
+	if err := m.storage.Move(context.Background(), filepath.Join(dir, "inbox", "a.ts"), "", filepath.Join(dir, "done")); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+
+	// the encoded file is kept until it is removed by others.
+	if err := m.SenderPerge(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if m.NumFiles() != 1 || !m.GetFile(filepath.Join(dir, "inbox", "a.ts")).Encoded {
+		t.Fatalf("want: a.ts encoded, out: %d files", m.NumFiles())
+	}
+	os.Remove(path)
+	if err := m.SenderPerge(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if m.NumFiles() != 0 {
+		t.Fatalf("want: 0 files, out: %d", m.NumFiles())
+	}
+}
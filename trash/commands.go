@@ -0,0 +1,158 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"time"
+)
+
+// runPrune removes the files in the directory given in args following the
+// retention policy.
+func runPrune(args []string) {
+	if len(args) != 1 {
+		log.Fatal("[prune] specify directory")
+	}
+	p, err := LoadPolicy(*policy)
+	if err != nil {
+		log.Fatalf("[prune] %v", err)
+	}
+	dir := args[0]
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		log.Fatalf("[prune] cannot read target dir: %v", err)
+	}
+	r := newRemover()
+	n, freed := r.remove(dir, p.Select(files, time.Now()))
+	r.summary(n, freed)
+}
+
+// runWatch keeps the disk usage of the directory given in args below the
+// watermarks.
+func runWatch(args []string) {
+	if len(args) != 1 {
+		log.Fatal("[watch] specify directory")
+	}
+	dir := args[0]
+	if _, _, err := diskUsage(dir); err != nil {
+		log.Fatalf("[watch] %v", err)
+	}
+	r := newRemover()
+	r.confirm = false
+	w := &watcher{
+		dir:   dir,
+		high:  *high,
+		low:   *low,
+		trash: r.trash,
+		r:     r,
+	}
+	r.trash = nil
+	log.Printf("[watch] watching %v every %v (high: %v, low: %v)", dir, *interval, *high, *low)
+	w.run(*interval)
+}
+
+// runRestore moves the trashed files whose original name or path matches
+// the glob patterns in args back to the original path.
+func runRestore(args []string) {
+	if len(args) == 0 {
+		log.Fatal("[restore] specify filename pattern")
+	}
+	t := newTrash()
+	files, err := t.List()
+	if err != nil {
+		log.Fatalf("[restore] cannot read trash: %v", err)
+	}
+	n := 0
+	for _, tf := range files {
+		matched := false
+		for _, a := range args {
+			ok1, err := filepath.Match(a, filepath.Base(tf.Path))
+			if err != nil {
+				log.Fatalf("[restore] invalid pattern %v: %v", a, err)
+			}
+			ok2, _ := filepath.Match(a, tf.Path)
+			if ok1 || ok2 {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("would restore %v\n", tf.Path)
+			n++
+			continue
+		}
+		if err := t.Restore(tf); err != nil {
+			log.Printf("[restore] failed to restore %v: %v", tf.Path, err)
+			continue
+		}
+		fmt.Printf("restored %v\n", tf.Path)
+		n++
+	}
+	if n == 0 {
+		log.Fatalf("[restore] no file matched in %v", t.Dir)
+	}
+}
+
+// runEmpty permanently removes the files trashed before the age given in
+// --older-than, or all the files if it is not given.
+func runEmpty(args []string) {
+	fs := flag.NewFlagSet("empty", flag.ExitOnError)
+	olderThan := fs.String("older-than", "", "remove only the files trashed before the age, such as 7d or 36h")
+	fs.Parse(args)
+
+	var age time.Duration
+	if *olderThan != "" {
+		var err error
+		if age, err = parseAge(*olderThan); err != nil {
+			log.Fatalf("[empty] %v", err)
+		}
+	}
+	t := newTrash()
+	files, err := t.List()
+	if err != nil {
+		log.Fatalf("[empty] cannot read trash: %v", err)
+	}
+	deadline := time.Now().Add(-age)
+	n := 0
+	var freed int64
+	for _, tf := range files {
+		if !tf.DeletionDate.Before(deadline) {
+			continue
+		}
+		if dryRun {
+			fmt.Printf("would remove %v (%v, trashed at %v)\n", tf.Path, formatSize(tf.Size), tf.DeletionDate.Format(time.ANSIC))
+		} else {
+			if err := t.Delete(tf); err != nil {
+				log.Printf("[empty] failed to remove %v: %v", tf.Name, err)
+				continue
+			}
+			fmt.Printf("removed %v (%v)\n", tf.Path, formatSize(tf.Size))
+		}
+		n++
+		freed += tf.Size
+	}
+	if dryRun {
+		fmt.Printf("%d files, %v would be freed\n", n, formatSize(freed))
+	} else {
+		fmt.Printf("removed %d files, %v freed\n", n, formatSize(freed))
+	}
+}
@@ -1,3 +1,14 @@
 module trash
 
 go 1.12
+
+require (
+	github.com/ymotongpoo/toolbox/epg v0.0.0
+	github.com/ymotongpoo/toolbox/sync-tool v0.0.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+replace (
+	github.com/ymotongpoo/toolbox/epg => ../epg
+	github.com/ymotongpoo/toolbox/sync-tool => ../sync-tool
+)
@@ -0,0 +1,130 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/sync-tool"
+)
+
+// guard returns nil if the file at path is confirmed to be processed and
+// safe to remove, or the reason why it should be kept.
+type guard func(path string) error
+
+// syncStateGuard returns guard which confirms the files recorded as both
+// encoded and uploaded in the sync-tool state file at statePath. The sender
+// records the files as encoded when it is run with -keep. Files are compared
+// by their names because sync-tool may run in another directory or machine.
+func syncStateGuard(statePath string) (guard, error) {
+	files, err := synctool.ReadState(statePath)
+	if err != nil {
+		return nil, err
+	}
+	done := map[string]bool{}
+	for _, sf := range files {
+		if sf != nil && sf.Encoded && sf.Uploaded {
+			done[filepath.Base(sf.Path)] = true
+		}
+	}
+	return func(path string) error {
+		if !done[filepath.Base(path)] {
+			return fmt.Errorf("not encoded and uploaded in %v", statePath)
+		}
+		return nil
+	}, nil
+}
+
+// probeDuration returns the duration of the media file at path with ffprobe.
+var probeDuration = func(path string) (time.Duration, error) {
+	out, err := exec.Command("ffprobe", "-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path).Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %v: %v", path, err)
+	}
+	sec, err := strconv.ParseFloat(strings.TrimSpace(string(out)), 64)
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe %v: invalid duration %q", path, out)
+	}
+	return time.Duration(sec * float64(time.Second)), nil
+}
+
+// encodedExts are the extensions of the files encoded by the profiles of
+// sync-tool, including the audio only one.
+var encodedExts = []string{".mp4", ".m4a"}
+
+// encodedPaths returns the candidate paths of the file encoded from the ts
+// file at path. sync-tool writes "<name>.ts.mp4", and others write
+// "<name>.mp4". It returns nil for the other files, so that the encoded files
+// are never confirmed by themselves.
+func encodedPaths(path string) []string {
+	if filepath.Ext(path) != ".ts" {
+		return nil
+	}
+	paths := []string{}
+	for _, ext := range encodedExts {
+		paths = append(paths, path+ext, strings.TrimSuffix(path, ".ts")+ext)
+	}
+	return paths
+}
+
+// mp4Guard returns guard which confirms the ts files with the sibling encoded
+// file whose duration is at least minRatio of the original.
+func mp4Guard(minRatio float64) guard {
+	return func(path string) error {
+		for _, enc := range encodedPaths(path) {
+			if _, err := os.Stat(enc); err != nil {
+				continue
+			}
+			src, err := probeDuration(path)
+			if err != nil {
+				return err
+			}
+			d, err := probeDuration(enc)
+			if err != nil {
+				return err
+			}
+			if float64(d) < float64(src)*minRatio {
+				return fmt.Errorf("%v is too short: %v of %v", enc, d.Round(time.Second), src.Round(time.Second))
+			}
+			return nil
+		}
+		return fmt.Errorf("encoded mp4 or m4a file not found")
+	}
+}
+
+// checkGuards returns nil if any of guards confirms path, or the reasons
+// from all the guards otherwise.
+func checkGuards(guards []guard, path string) error {
+	if len(guards) == 0 {
+		return nil
+	}
+	reasons := []string{}
+	for _, g := range guards {
+		err := g(path)
+		if err == nil {
+			return nil
+		}
+		reasons = append(reasons, err.Error())
+	}
+	return fmt.Errorf("%s", strings.Join(reasons, "; "))
+}
@@ -0,0 +1,125 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/sync-tool"
+)
+
+// senderState writes the sync-tool state file into dir with the sender on
+// local storage. uploaded are the files only uploaded, and encoded are the
+// files uploaded and found in the encode done folder.
+func senderState(t *testing.T, dir string, uploaded, encoded []string) string {
+	for _, d := range []string{"inbox", "done"} {
+		os.Mkdir(filepath.Join(dir, d), 0755)
+	}
+	c, err := synctool.ParseConfig([]byte(`
+storage:
+  type: local
+pipelines:
+  - name: default
+    inbox: ` + filepath.Join(dir, "inbox") + `
+    done: ` + filepath.Join(dir, "done") + `
+    output: ` + filepath.Join(dir, "done") + `
+`))
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	m := synctool.NewManager("")
+	m.SetConfig(c)
+	m.SetKeepOriginals(true)
+	if err := m.Init(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	statePath := filepath.Join(dir, synctool.DefaultStateFile)
+	if err := m.LoadState(statePath); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	for _, name := range append(uploaded, encoded...) {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(name), 0644); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if err := m.SenderAdd(path); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	if err := m.SenderUpload(context.Background()); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	// the receiver moves the files into the encode done folder.
+	for _, name := range encoded {
+		if err := os.Rename(filepath.Join(dir, "inbox", name), filepath.Join(dir, "done", name)); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	if err := m.SenderPerge(); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	return statePath
+}
+
+func Test_guards(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trash")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	statePath := senderState(t, dir, []string{"20180115T1000-f.ts"}, []string{"20180115T0730-a.ts"})
+	for _, name := range []string{"20180115T0800-b.ts.mp4", "20180115T0830-c.mp4", "20180115T1030-g.m4a", "20180115T1100-h.mp4"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	defer func(f func(string) (time.Duration, error)) { probeDuration = f }(probeDuration)
+	probeDuration = func(path string) (time.Duration, error) {
+		if strings.HasSuffix(path, "c.mp4") {
+			return 10 * time.Minute, nil
+		}
+		return 30 * time.Minute, nil
+	}
+
+	sg, err := syncStateGuard(statePath)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	guards := []guard{sg, mp4Guard(0.95)}
+	cases := map[string]bool{
+		"20180115T0730-a.ts": true,
+		"20180115T0800-b.ts": true,
+		"20180115T0830-c.ts": false,
+		"20180115T0900-d.ts": false,
+		// uploaded only is not enough.
+		"20180115T1000-f.ts": false,
+		"20180115T1030-g.ts": true,
+		// the encoded files don't confirm themselves.
+		"20180115T1030-g.m4a": false,
+		"20180115T1100-h.mp4": false,
+	}
+	for name, want := range cases {
+		err := checkGuards(guards, filepath.Join(dir, name))
+		if (err == nil) != want {
+			t.Fatalf("%s: want: %v, out: %v", name, want, err)
+		}
+	}
+}
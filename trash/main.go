@@ -15,18 +15,26 @@
 package main
 
 import (
+	"bufio"
 	"flag"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
+	"path/filepath"
 	"strings"
 	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
 )
 
 const (
-	timeonlyPattern  = "1504"
-	daytimePatten    = "01021504"
-	recordTimeFormat = "20060102T1504"
+	timeonlyPattern = "1504"
+	daytimePatten   = "01021504"
+	// recordTimeFormat is the prefix of the files recorded by gguide and
+	// auto-booking.
+	recordTimeFormat = epg.FilePrefixFormat
 )
 
 func parseTimeOnlyPattern(pattern string) (time.Time, error) {
@@ -64,9 +72,181 @@ func removeMatchedFiles(files []os.FileInfo, format string) []os.FileInfo {
 	return matched
 }
 
+var (
+	dryRun   bool
+	confirm  = flag.Bool("i", false, "prompt before every removal")
+	rm       = flag.Bool("rm", false, "remove files permanently instead of moving them into the trash")
+	trashDir = flag.String("trash-dir", "", "trash directory on the same filesystem as the files (default: XDG home trash)")
+	policy   = flag.String("policy", DefaultPolicyFile, "retention policy file for prune")
+	state    = flag.String("sync-state", "", "remove only the files recorded as encoded and uploaded in the sync-tool state file, written by the sender with -keep")
+	mp4      = flag.Bool("require-mp4", false, "remove only the ts files with the sibling mp4 or m4a file checked by ffprobe")
+	minRatio = flag.Float64("min-ratio", 0.95, "minimum ratio of the mp4 duration to the original for -require-mp4")
+	watch    = flag.Bool("watch", false, "run as a daemon to remove the oldest recordings permanently when the disk usage exceeds -high")
+	interval = flag.Duration("interval", 1*time.Minute, "interval to check the disk usage in -watch mode")
+	high     = flag.String("high", "90%", "disk usage to start removing files in -watch mode, in percentage or size")
+	low      = flag.String("low", "80%", "disk usage to stop removing files in -watch mode, in percentage or size")
+)
+
+func init() {
+	flag.BoolVar(&dryRun, "n", false, "list the files to be removed with their sizes without removing them")
+	flag.BoolVar(&dryRun, "dry-run", false, "same as -n")
+	flag.Usage = func() {
+		out := flag.CommandLine.Output()
+		fmt.Fprintln(out, "usage: trash [options] <HHMM|MMDDHHMM> <dir>")
+		fmt.Fprintln(out, "       trash [options] -watch <dir>")
+		fmt.Fprintln(out, "       trash [options] prune <dir>")
+		fmt.Fprintln(out, "       trash [options] restore <pattern>...")
+		fmt.Fprintln(out, "       trash [options] empty [--older-than 7d]")
+		flag.PrintDefaults()
+	}
+}
+
+// remover moves files into the trash, or removes them permanently if trash
+// is nil. It only lists the files in dry run mode.
+type remover struct {
+	dryRun  bool
+	confirm bool
+	trash   *Trash
+	// guards keep the files unless any of them confirms the file.
+	guards []guard
+	in     *bufio.Reader
+	out    io.Writer
+}
+
+// remove removes files in dir, and returns the number of the removed files
+// and their total size.
+func (r *remover) remove(dir string, files []os.FileInfo) (int, int64) {
+	n := 0
+	var freed int64
+	for _, f := range files {
+		if f.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, f.Name())
+		size := formatSize(f.Size())
+		verb, done := "remove", "removed"
+		if r.trash != nil {
+			verb, done = "trash", "trashed"
+		}
+		if err := checkGuards(r.guards, path); err != nil {
+			fmt.Fprintf(r.out, "keep %v: %v\n", path, err)
+			continue
+		}
+		if r.dryRun {
+			fmt.Fprintf(r.out, "would %v %v (%v)\n", verb, path, size)
+			n++
+			freed += f.Size()
+			continue
+		}
+		if r.confirm {
+			fmt.Fprintf(r.out, "%v %v (%v)? [y/N/q] ", verb, path, size)
+			answer, _ := r.in.ReadString('\n')
+			answer = strings.ToLower(strings.TrimSpace(answer))
+			if answer == "q" {
+				break
+			}
+			if answer != "y" && answer != "yes" {
+				continue
+			}
+		}
+		var err error
+		if r.trash != nil {
+			err = r.trash.Put(path, time.Now())
+		} else {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			log.Printf("failed to %v %v: %v", verb, path, err)
+			continue
+		}
+		fmt.Fprintf(r.out, "%v %v (%v)\n", done, path, size)
+		n++
+		freed += f.Size()
+	}
+	return n, freed
+}
+
+// summary prints the number of the removed files and their total size.
+func (r *remover) summary(n int, freed int64) {
+	switch {
+	case r.dryRun:
+		fmt.Fprintf(r.out, "%d files, %v would be freed\n", n, formatSize(freed))
+	case r.trash != nil:
+		fmt.Fprintf(r.out, "trashed %d files, %v freed after emptying %v\n", n, formatSize(freed), r.trash.Dir)
+	default:
+		fmt.Fprintf(r.out, "removed %d files, %v freed\n", n, formatSize(freed))
+	}
+}
+
+// formatSize formats the size in bytes into human readable string.
+func formatSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// newTrash returns the trash given in the flag.
+func newTrash() *Trash {
+	dir := *trashDir
+	if dir == "" {
+		var err error
+		if dir, err = DefaultTrashDir(); err != nil {
+			log.Fatalf("cannot find trash dir: %v", err)
+		}
+	}
+	return &Trash{Dir: dir}
+}
+
+// newRemover returns remover configured with the flags.
+func newRemover() *remover {
+	r := &remover{
+		dryRun:  dryRun,
+		confirm: *confirm,
+		in:      bufio.NewReader(os.Stdin),
+		out:     os.Stdout,
+	}
+	if !*rm {
+		r.trash = newTrash()
+	}
+	if *state != "" {
+		g, err := syncStateGuard(*state)
+		if err != nil {
+			log.Fatalf("cannot read sync-tool state: %v", err)
+		}
+		r.guards = append(r.guards, g)
+	}
+	if *mp4 {
+		r.guards = append(r.guards, mp4Guard(*minRatio))
+	}
+	return r
+}
+
 func main() {
 	flag.Parse()
+	switch flag.Arg(0) {
+	case "prune":
+		runPrune(flag.Args()[1:])
+		return
+	case "restore":
+		runRestore(flag.Args()[1:])
+		return
+	case "empty":
+		runEmpty(flag.Args()[1:])
+		return
+	}
+	if *watch {
+		runWatch(flag.Args())
+		return
+	}
 	if flag.NArg() < 2 {
+		flag.Usage()
 		log.Fatal("specify target time pattern and directory")
 	}
 
@@ -93,7 +273,7 @@ func main() {
 	}
 
 	matched := removeMatchedFiles(files, format)
-	for _, m := range matched {
-		os.Remove(m.Name())
-	}
+	r := newRemover()
+	n, freed := r.remove(dir, matched)
+	r.summary(n, freed)
 }
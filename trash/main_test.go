@@ -0,0 +1,76 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func Test_remove(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trash")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"20180115T0730-a.ts", "20180115T0800-b.ts", "20180116T0730-c.ts"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("0123456789"), 0644); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	matched := removeMatchedFiles(files, "20180115T2359")
+
+	out := &strings.Builder{}
+	r := &remover{dryRun: true, out: out}
+	if n, freed := r.remove(dir, matched); n != 2 || freed != 20 {
+		t.Fatalf("want: 2 files 20 bytes, out: %d files %d bytes", n, freed)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "20180115T0730-a.ts")); err != nil {
+		t.Fatalf("want: file kept in dry run, out: %s", err)
+	}
+
+	r = &remover{confirm: true, in: bufio.NewReader(strings.NewReader("n\ny\n")), out: out}
+	if n, freed := r.remove(dir, matched); n != 1 || freed != 10 {
+		t.Fatalf("want: 1 file 10 bytes, out: %d files %d bytes", n, freed)
+	}
+	rest, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(rest) != 2 || rest[0].Name() != "20180115T0730-a.ts" {
+		t.Fatalf("want: [20180115T0730-a.ts 20180116T0730-c.ts], out: %v", rest)
+	}
+}
+
+func Test_formatSize(t *testing.T) {
+	cases := map[int64]string{
+		512:             "512 B",
+		1536:            "1.5 KiB",
+		3 * 1024 * 1024: "3.0 MiB",
+	}
+	for size, want := range cases {
+		if out := formatSize(size); out != want {
+			t.Fatalf("want: %s, out: %s", want, out)
+		}
+	}
+}
@@ -0,0 +1,275 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultPolicyFile is the filename of the YAML file of the retention policy.
+const DefaultPolicyFile = "retention.yaml"
+
+// Policy is the retention policy of the recordings. The files kept by
+// KeepEpisodes or KeepNewerThan are never removed unless MaxUsage is exceeded,
+// and the files matching Protect are never removed at all.
+//
+//	keep_episodes: 3       # keep the last 3 episodes of each series
+//	keep_newer_than: 7d    # keep everything recorded within 7 days
+//	protect:               # keep the titles matching the regular expressions
+//	  - スペシャル
+//	max_usage: 500GiB      # remove the oldest ones while the total exceeds it
+type Policy struct {
+	KeepEpisodes  int
+	KeepNewerThan Age
+	Protect       []*regexp.Regexp
+	MaxUsage      Size
+}
+
+type policySpec struct {
+	KeepEpisodes  int      `yaml:"keep_episodes"`
+	KeepNewerThan Age      `yaml:"keep_newer_than"`
+	Protect       []string `yaml:"protect"`
+	MaxUsage      Size     `yaml:"max_usage"`
+}
+
+// LoadPolicy reads the retention policy from the YAML file at path.
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p, err := ParsePolicy(b)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return p, nil
+}
+
+// ParsePolicy parses the retention policy in YAML.
+func ParsePolicy(b []byte) (*Policy, error) {
+	var spec policySpec
+	if err := yaml.Unmarshal(b, &spec); err != nil {
+		return nil, err
+	}
+	p := &Policy{
+		KeepEpisodes:  spec.KeepEpisodes,
+		KeepNewerThan: spec.KeepNewerThan,
+		MaxUsage:      spec.MaxUsage,
+	}
+	for _, s := range spec.Protect {
+		re, err := regexp.Compile(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid protect pattern %q: %v", s, err)
+		}
+		p.Protect = append(p.Protect, re)
+	}
+	if p.KeepEpisodes < 0 {
+		return nil, fmt.Errorf("keep_episodes must not be negative: %d", p.KeepEpisodes)
+	}
+	return p, nil
+}
+
+// Age is the duration which accepts days such as "7d" in YAML.
+type Age time.Duration
+
+// UnmarshalYAML parses the age with parseAge.
+func (a *Age) UnmarshalYAML(n *yaml.Node) error {
+	d, err := parseAge(n.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %v", n.Line, err)
+	}
+	*a = Age(d)
+	return nil
+}
+
+// Size is the size in bytes which accepts units such as "500GiB" in YAML.
+type Size int64
+
+// UnmarshalYAML parses the size with parseSize.
+func (s *Size) UnmarshalYAML(n *yaml.Node) error {
+	size, err := parseSize(n.Value)
+	if err != nil {
+		return fmt.Errorf("line %d: %v", n.Line, err)
+	}
+	*s = Size(size)
+	return nil
+}
+
+// parseSize parses the size such as "500G", "500GB" or "500GiB". All the
+// units are binary prefixes.
+func parseSize(s string) (int64, error) {
+	num := strings.TrimRight(s, "KMGTPiB")
+	unit := strings.TrimSuffix(strings.TrimSuffix(s[len(num):], "B"), "i")
+	n, err := strconv.ParseFloat(strings.TrimSpace(num), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size: %v", s)
+	}
+	exp := 0
+	if unit != "" {
+		exp = strings.Index("KMGTP", unit) + 1
+		if exp == 0 || len(unit) != 1 {
+			return 0, fmt.Errorf("invalid size unit: %v", s)
+		}
+	}
+	for i := 0; i < exp; i++ {
+		n *= 1024
+	}
+	return int64(n), nil
+}
+
+// recording is a file recorded in "20060102T1504-<title>.ts" format.
+type recording struct {
+	os.FileInfo
+	start  time.Time
+	title  string
+	series string
+}
+
+// parseRecording returns recording of fi, or false if the name of fi is not
+// in the format of recorded files.
+func parseRecording(fi os.FileInfo) (*recording, bool) {
+	name := fi.Name()
+	if fi.IsDir() || !strings.HasSuffix(name, ".ts") || len(name) <= len(recordTimeFormat)+1 || name[len(recordTimeFormat)] != '-' {
+		return nil, false
+	}
+	start, err := time.ParseInLocation(recordTimeFormat, name[:len(recordTimeFormat)], time.Local)
+	if err != nil {
+		return nil, false
+	}
+	title := strings.TrimSuffix(name[len(recordTimeFormat)+1:], ".ts")
+	return &recording{
+		FileInfo: fi,
+		start:    start,
+		title:    title,
+		series:   seriesTitle(title),
+	}, true
+}
+
+// markerRegexp matches each of the markers such as "[字]" and "[新]" in the
+// title, which are "【字】" and "【新】" in the filenames.
+var markerRegexp = regexp.MustCompile(`[\[【][^\]】]*[\]】]`)
+
+// episodeRegexp matches the episode number and subtitle in the title. The
+// separators before them are "_" and full-width spaces as well since the
+// titles in the filenames are sanitized.
+var episodeRegexp = regexp.MustCompile(`[\s_\x{3000}]*(#\d+|＃[0-9０-９]+|第[0-9０-９一二三四五六七八九十百]+[話回]|[(（][0-9０-９]+[)）]|「[^」]*」).*$`)
+
+// seriesTitle returns the title of the series by removing the markers and
+// the episode part from title.
+func seriesTitle(title string) string {
+	t := markerRegexp.ReplaceAllString(title, "")
+	if s := strings.TrimFunc(episodeRegexp.ReplaceAllString(t, ""), isSeparator); s != "" {
+		return s
+	}
+	return title
+}
+
+// isSeparator returns true for the spaces including full-width ones and "_",
+// which is the space replaced in the filenames.
+func isSeparator(r rune) bool {
+	return unicode.IsSpace(r) || r == '_'
+}
+
+// Select returns the files to be removed from files under p at now, oldest
+// first. Files not in the format of recorded files are always kept.
+func (p *Policy) Select(files []os.FileInfo, now time.Time) []os.FileInfo {
+	recs := []*recording{}
+	for _, fi := range files {
+		if r, ok := parseRecording(fi); ok && !p.protected(r) {
+			recs = append(recs, r)
+		}
+	}
+	sort.Slice(recs, func(i, j int) bool { return recs[i].start.Before(recs[j].start) })
+
+	keep := map[*recording]bool{}
+	if p.KeepEpisodes > 0 || p.KeepNewerThan > 0 {
+		if p.KeepEpisodes > 0 {
+			bySeries := map[string][]*recording{}
+			for _, r := range recs {
+				bySeries[r.series] = append(bySeries[r.series], r)
+			}
+			for _, rs := range bySeries {
+				for i := len(rs) - 1; i >= 0 && i >= len(rs)-p.KeepEpisodes; i-- {
+					keep[rs[i]] = true
+				}
+			}
+		}
+		if p.KeepNewerThan > 0 {
+			deadline := now.Add(-time.Duration(p.KeepNewerThan))
+			for _, r := range recs {
+				if r.start.After(deadline) {
+					keep[r] = true
+				}
+			}
+		}
+	} else {
+		for _, r := range recs {
+			keep[r] = true
+		}
+	}
+
+	var usage int64
+	for _, fi := range files {
+		if !fi.IsDir() {
+			usage += fi.Size()
+		}
+	}
+	removed := map[*recording]bool{}
+	for _, r := range recs {
+		if !keep[r] {
+			removed[r] = true
+			usage -= r.Size()
+		}
+	}
+	if p.MaxUsage > 0 {
+		for _, r := range recs {
+			if usage <= int64(p.MaxUsage) {
+				break
+			}
+			if !removed[r] {
+				removed[r] = true
+				usage -= r.Size()
+			}
+		}
+	}
+
+	selected := []os.FileInfo{}
+	for _, r := range recs {
+		if removed[r] {
+			selected = append(selected, r.FileInfo)
+		}
+	}
+	return selected
+}
+
+// protected returns true if r matches any of the protect patterns.
+func (p *Policy) protected(r *recording) bool {
+	for _, re := range p.Protect {
+		if re.MatchString(r.title) {
+			return true
+		}
+	}
+	return false
+}
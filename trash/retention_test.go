@@ -0,0 +1,115 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ymotongpoo/toolbox/epg"
+)
+
+// fakeFile is os.FileInfo of the file with the name and size.
+type fakeFile struct {
+	name string
+	size int64
+}
+
+func (f fakeFile) Name() string       { return f.name }
+func (f fakeFile) Size() int64        { return f.size }
+func (f fakeFile) Mode() os.FileMode  { return 0644 }
+func (f fakeFile) ModTime() time.Time { return time.Time{} }
+func (f fakeFile) IsDir() bool        { return false }
+func (f fakeFile) Sys() interface{}   { return nil }
+
+func names(files []os.FileInfo) string {
+	ns := []string{}
+	for _, f := range files {
+		ns = append(ns, f.Name())
+	}
+	return strings.Join(ns, " ")
+}
+
+func Test_PolicySelect(t *testing.T) {
+	files := []os.FileInfo{
+		fakeFile{"20180101T2100-ドラマ #1.ts", 10},
+		fakeFile{"20180108T2100-ドラマ #2.ts", 10},
+		fakeFile{"20180115T2100-ドラマ #3.ts", 10},
+		fakeFile{"20180102T2100-ドラマ スペシャル.ts", 10},
+		fakeFile{"20180110T0730-ニュース.ts", 10},
+		fakeFile{"20180114T0730-ニュース.ts", 10},
+		fakeFile{"notes.txt", 10},
+	}
+	now := time.Date(2018, 1, 16, 0, 0, 0, 0, time.Local)
+	cases := []struct {
+		yaml string
+		want string
+	}{
+		{"keep_episodes: 2", "20180101T2100-ドラマ #1.ts"},
+		{"keep_episodes: 1\nkeep_newer_than: 3d",
+			"20180101T2100-ドラマ #1.ts 20180108T2100-ドラマ #2.ts 20180110T0730-ニュース.ts"},
+		{"keep_episodes: 1\nprotect: [スペシャル, ニュース]", "20180101T2100-ドラマ #1.ts 20180108T2100-ドラマ #2.ts"},
+		{"max_usage: 45B", "20180101T2100-ドラマ #1.ts 20180102T2100-ドラマ スペシャル.ts 20180108T2100-ドラマ #2.ts"},
+	}
+	for _, c := range cases {
+		p, err := ParsePolicy([]byte(c.yaml))
+		if err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if out := names(p.Select(files, now)); out != c.want {
+			t.Fatalf("%q: want: %s, out: %s", c.yaml, c.want, out)
+		}
+	}
+}
+
+func Test_DefaultPolicyFile(t *testing.T) {
+	p, err := LoadPolicy(DefaultPolicyFile)
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if p.KeepEpisodes != 3 || time.Duration(p.KeepNewerThan) != 7*24*time.Hour || p.MaxUsage != 500<<30 {
+		t.Fatalf("want: 3 episodes, 7 days, 500GiB, out: %+v", p)
+	}
+}
+
+func Test_seriesTitle(t *testing.T) {
+	start := time.Date(2018, 1, 15, 21, 0, 0, 0, time.Local)
+	cases := map[string]string{
+		"ドラマ #12": "ドラマ",
+		"ドラマ　#12": "ドラマ",
+		"アニメ 第3話「サブタイトル」": "アニメ",
+		"映画 (2)":    "映画",
+		"ニュース [字]":  "ニュース",
+		"ドラマ スペシャル": "ドラマ_スペシャル",
+		"#1":        "＃1",
+		// the markers are removed one by one wherever they are.
+		"[新]ドラマ #1":     "ドラマ",
+		"[新]アニメ #1 [字]": "アニメ",
+		"[映][字]映画 (2)":  "映画",
+	}
+	for title, want := range cases {
+		// the filenames are the ones recorded by gguide and auto-booking.
+		p := &epg.Program{Title: title, Start: start}
+		r, ok := parseRecording(fakeFile{p.Filename(), 10})
+		if !ok {
+			t.Fatalf("%s: want: recording, out: %s", title, p.Filename())
+		}
+		if r.series != want {
+			t.Fatalf("%s: want: %s, out: %s", title, want, r.series)
+		}
+	}
+}
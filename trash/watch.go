@@ -0,0 +1,168 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// writingMargin is the period to regard the file as being written by recpt1.
+const writingMargin = 1 * time.Minute
+
+// diskUsage returns the total and the used bytes of the filesystem of dir.
+func diskUsage(dir string) (int64, int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(dir, &st); err != nil {
+		return 0, 0, err
+	}
+	total := int64(st.Blocks) * int64(st.Bsize)
+	free := int64(st.Bavail) * int64(st.Bsize)
+	return total, total - free, nil
+}
+
+// parseWatermark parses the watermark of the disk usage given in percentage
+// such as "90%", or in size such as "900GiB", into bytes.
+func parseWatermark(s string, total int64) (int64, error) {
+	if strings.HasSuffix(s, "%") {
+		p, err := strconv.ParseFloat(strings.TrimSuffix(s, "%"), 64)
+		if err != nil || p < 0 || p > 100 {
+			return 0, fmt.Errorf("invalid watermark: %v", s)
+		}
+		return int64(float64(total) * p / 100), nil
+	}
+	return parseSize(s)
+}
+
+// sameDevice returns true if a and b are on the same filesystem.
+func sameDevice(a, b string) bool {
+	var sa, sb syscall.Stat_t
+	if syscall.Stat(a, &sa) != nil || syscall.Stat(b, &sb) != nil {
+		return false
+	}
+	return sa.Dev == sb.Dev
+}
+
+// watcher removes the oldest recordings in dir when the disk usage exceeds
+// the high watermark until it goes below the low watermark. The recordings
+// are removed permanently because moving them into the trash on the same
+// filesystem doesn't free the disk. Instead, the files in trash are removed
+// before the recordings.
+type watcher struct {
+	dir   string
+	high  string
+	low   string
+	trash *Trash
+	r     *remover
+}
+
+// run checks the disk usage every interval forever.
+func (w *watcher) run(interval time.Duration) {
+	for {
+		if err := w.check(time.Now()); err != nil {
+			log.Printf("[watch] %v", err)
+		}
+		time.Sleep(interval)
+	}
+}
+
+// check removes the files if the disk usage exceeds the high watermark.
+func (w *watcher) check(now time.Time) error {
+	total, used, err := diskUsage(w.dir)
+	if err != nil {
+		return err
+	}
+	high, err := parseWatermark(w.high, total)
+	if err != nil {
+		return err
+	}
+	low, err := parseWatermark(w.low, total)
+	if err != nil {
+		return err
+	}
+	if used < high {
+		return nil
+	}
+	needed := used - low
+	log.Printf("[watch] %v used in %v exceeds %v, freeing %v", formatSize(used), w.dir, w.high, formatSize(needed))
+
+	// files in the trash on the same filesystem occupy the disk, so they
+	// are removed first.
+	var freed int64
+	if w.trash != nil && sameDevice(w.dir, w.trash.Dir) {
+		files, err := w.trash.List()
+		if err != nil {
+			return err
+		}
+		for _, tf := range files {
+			if freed >= needed {
+				break
+			}
+			if w.r.dryRun {
+				fmt.Fprintf(w.r.out, "would remove %v from trash (%v)\n", tf.Path, formatSize(tf.Size))
+			} else {
+				if err := w.trash.Delete(tf); err != nil {
+					log.Printf("[watch] failed to remove %v from trash: %v", tf.Name, err)
+					continue
+				}
+				fmt.Fprintf(w.r.out, "removed %v from trash (%v)\n", tf.Path, formatSize(tf.Size))
+			}
+			freed += tf.Size
+		}
+	}
+
+	files, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return err
+	}
+	n := 0
+	for _, f := range w.candidates(files, now) {
+		if freed >= needed {
+			break
+		}
+		rn, rf := w.r.remove(w.dir, []os.FileInfo{f})
+		n += rn
+		freed += rf
+	}
+	w.r.summary(n, freed)
+	if freed < needed {
+		return fmt.Errorf("freed %v but %v is required to reach %v", formatSize(freed), formatSize(needed), w.low)
+	}
+	return nil
+}
+
+// candidates returns the recordings started before now and not being written
+// any more, oldest first.
+func (w *watcher) candidates(files []os.FileInfo, now time.Time) []os.FileInfo {
+	cs := []os.FileInfo{}
+	for _, f := range removeMatchedFiles(files, now.Format(recordTimeFormat)) {
+		if _, ok := parseRecording(f); !ok {
+			continue
+		}
+		if now.Sub(f.ModTime()) < writingMargin {
+			continue
+		}
+		cs = append(cs, f)
+	}
+	sort.Slice(cs, func(i, j int) bool { return cs[i].Name() < cs[j].Name() })
+	return cs
+}
@@ -0,0 +1,51 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func Test_candidates(t *testing.T) {
+	files := []os.FileInfo{
+		fakeFile{"20180115T2100-ドラマ #3.ts", 10},
+		fakeFile{"20180101T2100-ドラマ #1.ts", 10},
+		fakeFile{"20180116T0730-ニュース.ts", 10},
+		fakeFile{"0001-notes.txt", 10},
+	}
+	now := time.Date(2018, 1, 16, 0, 0, 0, 0, time.Local)
+	w := &watcher{}
+	want := "20180101T2100-ドラマ #1.ts 20180115T2100-ドラマ #3.ts"
+	if out := names(w.candidates(files, now)); out != want {
+		t.Fatalf("want: %s, out: %s", want, out)
+	}
+}
+
+func Test_parseWatermark(t *testing.T) {
+	cases := map[string]int64{
+		"90%":    900,
+		"12.5%":  125,
+		"512B":   512,
+		"1.5KiB": 1536,
+	}
+	for s, want := range cases {
+		out, err := parseWatermark(s, 1000)
+		if err != nil || out != want {
+			t.Fatalf("%s: want: %d, out: %d (%v)", s, want, out, err)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// trashInfoExt is the extension of the metadata file of the trashed file.
+	trashInfoExt = ".trashinfo"
+
+	// deletionDateFormat is the format of DeletionDate in the metadata.
+	deletionDateFormat = "2006-01-02T15:04:05"
+)
+
+// DefaultTrashDir returns the home trash directory in the XDG trash
+// specification, "$XDG_DATA_HOME/Trash" or "~/.local/share/Trash".
+func DefaultTrashDir() (string, error) {
+	if d := os.Getenv("XDG_DATA_HOME"); d != "" {
+		return filepath.Join(d, "Trash"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".local", "share", "Trash"), nil
+}
+
+// Trash is the trash directory in the XDG trash specification, which has
+// "files" directory for the trashed files and "info" directory for their
+// metadata.
+type Trash struct {
+	Dir string
+}
+
+// TrashedFile is a file in the trash.
+type TrashedFile struct {
+	// Name is the filename in the trash.
+	Name string
+	// Path is the original path of the file.
+	Path         string
+	DeletionDate time.Time
+	Size         int64
+}
+
+func (t *Trash) filesDir() string { return filepath.Join(t.Dir, "files") }
+func (t *Trash) infoDir() string  { return filepath.Join(t.Dir, "info") }
+
+// Put moves the file at path into t. The file must be on the same
+// filesystem as t.
+func (t *Trash) Put(path string, now time.Time) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	for _, d := range []string{t.filesDir(), t.infoDir()} {
+		if err := os.MkdirAll(d, 0700); err != nil {
+			return err
+		}
+	}
+	base := filepath.Base(abs)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name = fmt.Sprintf("%s.%d", base, i)
+		}
+		// the metadata file is created exclusively first to reserve the name.
+		info := filepath.Join(t.infoDir(), name+trashInfoExt)
+		f, err := os.OpenFile(info, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			(&url.URL{Path: abs}).EscapedPath(), now.Format(deletionDateFormat))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err == nil {
+			if _, serr := os.Lstat(filepath.Join(t.filesDir(), name)); serr == nil {
+				os.Remove(info)
+				continue
+			}
+			err = os.Rename(abs, filepath.Join(t.filesDir(), name))
+		}
+		if err != nil {
+			os.Remove(info)
+			if errors.Is(err, syscall.EXDEV) {
+				return fmt.Errorf("%v is not on the same filesystem as %v: specify the trash directory on it with -trash-dir", path, t.Dir)
+			}
+			return err
+		}
+		return nil
+	}
+}
+
+// List returns the files in t sorted by deletion date.
+func (t *Trash) List() ([]*TrashedFile, error) {
+	infos, err := ioutil.ReadDir(t.infoDir())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	files := []*TrashedFile{}
+	for _, info := range infos {
+		if !strings.HasSuffix(info.Name(), trashInfoExt) {
+			continue
+		}
+		tf, err := t.readInfo(strings.TrimSuffix(info.Name(), trashInfoExt))
+		if err != nil {
+			return nil, err
+		}
+		if tf != nil {
+			files = append(files, tf)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].DeletionDate.Before(files[j].DeletionDate)
+	})
+	return files, nil
+}
+
+// readInfo reads the metadata of the file with the name in t. It returns nil
+// if the trashed file itself doesn't exist.
+func (t *Trash) readInfo(name string) (*TrashedFile, error) {
+	fi, err := os.Lstat(filepath.Join(t.filesDir(), name))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(t.infoDir(), name+trashInfoExt))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	tf := &TrashedFile{Name: name, Size: fi.Size()}
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		kv := strings.SplitN(s.Text(), "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "Path":
+			if tf.Path, err = url.PathUnescape(kv[1]); err != nil {
+				return nil, fmt.Errorf("%v: invalid path: %v", name, err)
+			}
+			if !filepath.IsAbs(tf.Path) {
+				tf.Path = filepath.Join(filepath.Dir(t.Dir), tf.Path)
+			}
+		case "DeletionDate":
+			if tf.DeletionDate, err = time.ParseInLocation(deletionDateFormat, kv[1], time.Local); err != nil {
+				return nil, fmt.Errorf("%v: invalid deletion date: %v", name, err)
+			}
+		}
+	}
+	return tf, s.Err()
+}
+
+// Restore moves tf back to its original path. It fails if a file already
+// exists there.
+func (t *Trash) Restore(tf *TrashedFile) error {
+	if _, err := os.Lstat(tf.Path); err == nil {
+		return fmt.Errorf("%v already exists", tf.Path)
+	}
+	if err := os.Rename(filepath.Join(t.filesDir(), tf.Name), tf.Path); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(t.infoDir(), tf.Name+trashInfoExt))
+}
+
+// Delete removes tf from t permanently.
+func (t *Trash) Delete(tf *TrashedFile) error {
+	if err := os.RemoveAll(filepath.Join(t.filesDir(), tf.Name)); err != nil {
+		return err
+	}
+	return os.Remove(filepath.Join(t.infoDir(), tf.Name+trashInfoExt))
+}
+
+// parseAge parses the age such as "7d" or "36h".
+func parseAge(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return 0, fmt.Errorf("invalid age: %v", s)
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
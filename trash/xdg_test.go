@@ -0,0 +1,89 @@
+//    Copyright 2018 Yoshi Yamaguchi
+//
+//    Licensed under the Apache License, Version 2.0 (the "License");
+//    you may not use this file except in compliance with the License.
+//    You may obtain a copy of the License at
+//
+//        http://www.apache.org/licenses/LICENSE-2.0
+//
+//    Unless required by applicable law or agreed to in writing, software
+//    distributed under the License is distributed on an "AS IS" BASIS,
+//    WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+//    See the License for the specific language governing permissions and
+//    limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func Test_Trash(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trash")
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	defer os.RemoveAll(dir)
+	trash := &Trash{Dir: filepath.Join(dir, "Trash")}
+	path := filepath.Join(dir, "20180115T0730-ピタゴラ スイッチ.ts")
+	now := time.Date(2018, 1, 15, 9, 0, 0, 0, time.Local)
+	for i := 0; i < 2; i++ {
+		if err := ioutil.WriteFile(path, []byte("recorded"), 0644); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+		if err := trash.Put(path, now.Add(time.Duration(i)*time.Hour)); err != nil {
+			t.Fatalf("error: %s", err)
+		}
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("want: %s moved, out: %v", path, err)
+	}
+
+	files, err := trash.List()
+	if err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("want: 2 files, out: %d", len(files))
+	}
+	first, second := files[0], files[1]
+	if first.Path != path || !first.DeletionDate.Equal(now) || first.Size != 8 {
+		t.Fatalf("want: %s %s 8, out: %s %s %d", path, now, first.Path, first.DeletionDate, first.Size)
+	}
+	if second.Name != filepath.Base(path)+".2" {
+		t.Fatalf("want: %s.2, out: %s", filepath.Base(path), second.Name)
+	}
+
+	if err := trash.Restore(first); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("want: %s restored, out: %s", path, err)
+	}
+	if err := trash.Restore(second); err == nil {
+		t.Fatalf("want: error on existing %s, out: nil", path)
+	}
+	if err := trash.Delete(second); err != nil {
+		t.Fatalf("error: %s", err)
+	}
+	if files, _ := trash.List(); len(files) != 0 {
+		t.Fatalf("want: empty trash, out: %d files", len(files))
+	}
+}
+
+func Test_parseAge(t *testing.T) {
+	cases := map[string]time.Duration{
+		"7d":  7 * 24 * time.Hour,
+		"36h": 36 * time.Hour,
+	}
+	for s, want := range cases {
+		out, err := parseAge(s)
+		if err != nil || out != want {
+			t.Fatalf("want: %s, out: %s (%v)", want, out, err)
+		}
+	}
+}